@@ -0,0 +1,331 @@
+// Package api serves a local HTTP/JSON API mirroring the operations of the GUI,
+// letting third-party tools and bots interact with the forum.
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"dforum-app/configuration"
+	"dforum-app/network"
+	"dforum-app/security"
+	"dforum-app/storage"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	apiPrefix = "/api/v1/"
+	// Children listed for a node
+	maxChildren = 50
+)
+
+//go:embed openapi.json
+var openAPIDescription []byte
+
+var errNotLoopback = errors.New("the API can only listen on a loopback address")
+
+// Node as returned by the API, the stats, depth and attachments shown by the GUI are left out
+type Node struct {
+	ID             string
+	Parent         string
+	Short          string
+	Long           string
+	Indicator      int
+	Timestamp      int64
+	ContextLoading bool
+}
+
+// Replies to a node, Truncated being set when more than maxChildren were found
+type Children struct {
+	Nodes     []Node
+	Truncated bool
+}
+
+// Body of requests creating nodes, an empty parent creating a topic
+type NewNode struct {
+	Parent    string
+	Short     string
+	Long      string
+	Indicator int
+}
+
+type Status struct {
+	Topics  int
+	Orphans int
+	Network *network.NetworkStatus `json:",omitempty"`
+}
+
+type apiError struct {
+	Error string
+}
+
+type Server struct {
+	storageModule *storage.StorageModule
+	networkModule *network.NetworkModule // Unset when only the storage is served
+	token         string
+	events        *eventHub
+	mux           *http.ServeMux
+	httpServer    *http.Server
+}
+
+func NewServer(sm *storage.StorageModule, nm *network.NetworkModule, token string) *Server {
+	s := &Server{
+		storageModule: sm,
+		networkModule: nm,
+		token:         token,
+		events:        newEventHub(sm),
+		mux:           http.NewServeMux(),
+	}
+	s.mux.HandleFunc(apiPrefix+"openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc(apiPrefix+"topics", s.authenticated(s.handleTopics))
+	s.mux.HandleFunc(apiPrefix+"nodes", s.authenticated(s.handleCreateNode))
+	s.mux.HandleFunc(apiPrefix+"nodes/", s.authenticated(s.handleNode))
+	s.mux.HandleFunc(apiPrefix+"status", s.authenticated(s.handleStatus))
+	s.mux.HandleFunc(apiPrefix+"events", s.authenticated(s.handleEvents))
+	s.mux.HandleFunc(apiPrefix+"feed.atom", s.authenticated(s.handleFeed(true)))
+	s.mux.HandleFunc(apiPrefix+"feed.rss", s.authenticated(s.handleFeed(false)))
+	return s
+}
+
+// Start the API on the configured address if it is enabled
+func StartFromConfig(sm *storage.StorageModule, nm *network.NetworkModule) *Server {
+	if !configuration.IsApiEnabled() {
+		return nil
+	}
+	token := configuration.GetApiToken()
+	if token == "" {
+		token = newToken()
+		configuration.SetApiToken(token)
+		configuration.Logger.Info("generated a new API token, see api.token in the config file")
+	}
+	s := NewServer(sm, nm, token)
+	if err := s.Start(configuration.GetApiAddress()); err != nil {
+		configuration.Logger.Error("could not start the HTTP API:", err.Error())
+		return nil
+	}
+	return s
+}
+
+// Listen on a loopback address, the API is not meant to be reachable from other hosts
+func (s *Server) Start(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return errNotLoopback
+	}
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.httpServer = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	configuration.Logger.Info("serving the HTTP API on:", l.Addr().String())
+	go s.httpServer.Serve(l)
+	return nil
+}
+
+func (s *Server) Close() {
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Require the API token, either as a bearer token, in the X-API-Token header
+// or in the token query parameter for clients that cannot set headers such as EventSource
+func (s *Server) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if v := r.Header.Get("X-API-Token"); v != "" {
+			token = v
+		}
+		if v := r.Header.Get("Authorization"); strings.HasPrefix(v, "Bearer ") {
+			token = strings.TrimPrefix(v, "Bearer ")
+		}
+		if s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid API token")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDescription)
+}
+
+// GET lists topics, POST creates one
+func (s *Server) handleTopics(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, nodesToApiNodes(s.storageModule.GetTopLevelNodes()))
+	case http.MethodPost:
+		s.createNode(w, r, true)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleCreateNode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.createNode(w, r, false)
+}
+
+// Serves /nodes/{id} and /nodes/{id}/children
+func (s *Server) handleNode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix+"nodes/")
+	id, children := strings.TrimSuffix(path, "/children"), strings.HasSuffix(path, "/children")
+	hash, ok := hashFromBase64(id)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid node ID")
+		return
+	}
+	if children {
+		order := storage.OrderOldest
+		if v := r.URL.Query().Get("order"); v != "" {
+			if order, ok = storage.ParseSortOrder(v); !ok {
+				writeError(w, http.StatusBadRequest, "invalid order")
+				return
+			}
+		}
+		// One more child than listed tells whether some were left out
+		nodes := s.storageModule.GetSortedChildrenNodes(hash, order, 0, maxChildren+1)
+		truncated := len(nodes) > maxChildren
+		if truncated {
+			nodes = nodes[:maxChildren]
+		}
+		writeJSON(w, http.StatusOK, Children{Nodes: nodesToApiNodes(nodes), Truncated: truncated})
+		return
+	}
+	n := s.storageModule.GetNode(hash, false)
+	if n == nil {
+		writeError(w, http.StatusNotFound, "node not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.convertNode(n))
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := Status{
+		Topics:  len(s.storageModule.GetTopLevelNodes()),
+		Orphans: len(s.storageModule.GetOrphanNodes()),
+	}
+	if s.networkModule != nil {
+		networkStatus := s.networkModule.GetStatus()
+		status.Network = &networkStatus
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) createNode(w http.ResponseWriter, r *http.Request, topic bool) {
+	var req NewNode
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	parent := security.HashSignature{}
+	indicator := int8(req.Indicator)
+	if topic {
+		indicator = -1 // As set by the GUI for topics
+	} else {
+		// Indicators range from 0, completely disagreeing, to 10, 5 being neutral
+		if req.Indicator < 0 || req.Indicator > 10 {
+			writeError(w, http.StatusBadRequest, "indicator must be between 0 and 10")
+			return
+		}
+		hash, ok := hashFromBase64(req.Parent)
+		if !ok || !s.storageModule.NodeExists(hash) {
+			writeError(w, http.StatusBadRequest, "unknown parent")
+			return
+		}
+		parent = hash
+	}
+	if req.Short == "" {
+		writeError(w, http.StatusBadRequest, "missing title")
+		return
+	}
+	n := storage.NewNode(req.Short, req.Long, indicator, parent)
+	if n == nil {
+		writeError(w, http.StatusInternalServerError, "failed to create node")
+		return
+	}
+	s.storageModule.StoreAndRegisterNewNode(n)
+	writeJSON(w, http.StatusCreated, s.convertNode(n))
+}
+
+func (s *Server) convertNode(n *storage.Node) Node {
+	node := convertNode(n)
+	node.ContextLoading = s.storageModule.IsOrphan(n)
+	return node
+}
+
+// Votes are only counted in the results of their poll, they are not listed
+func nodesToApiNodes(nodes []*storage.Node) []Node {
+	apiNodes := []Node{}
+	for _, n := range nodes {
+		if n != nil && !n.IsVote() {
+			apiNodes = append(apiNodes, convertNode(n))
+		}
+	}
+	return apiNodes
+}
+
+func convertNode(n *storage.Node) Node {
+	return Node{
+		ID:        encodeHash(n.SecObj.Fingerprint),
+		Parent:    encodeHash(n.DatObj.Parent),
+		Short:     n.DatObj.Topic,
+		Long:      n.DatObj.Content,
+		Indicator: int(n.DatObj.Indicator),
+		Timestamp: n.GetTimestamp(),
+	}
+}
+
+func encodeHash(hash security.HashSignature) string {
+	return base64.URLEncoding.EncodeToString(hash[:])
+}
+
+func hashFromBase64(base64Id string) (security.HashSignature, bool) {
+	hash, err := base64.URLEncoding.DecodeString(base64Id)
+	if err != nil || len(hash) != len(security.HashSignature{}) {
+		return security.HashSignature{}, false
+	}
+	return *(*[28]byte)(hash), true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		configuration.Logger.Error("failed to write API response:", err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, apiError{Error: message})
+}
+
+func newToken() string {
+	token := make([]byte, 32)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
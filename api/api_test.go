@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"dforum-app/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const testToken = "secret"
+
+func newTestServer(t *testing.T, path string) (*httptest.Server, *storage.StorageModule) {
+	previous := viper.Get("security.proofofwork-level")
+	viper.Set("security.proofofwork-level", 16)
+	t.Cleanup(func() { viper.Set("security.proofofwork-level", previous) })
+	os.RemoveAll(path)
+	sM := storage.NewStorageModule(path)
+	t.Cleanup(sM.TearDown)
+	ts := httptest.NewServer(NewServer(sM, nil, testToken))
+	t.Cleanup(ts.Close)
+	return ts, sM
+}
+
+func request(t *testing.T, method string, url string, body interface{}, v interface{}) int {
+	var reader *bytes.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, url, reader)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp.StatusCode
+}
+
+func TestCreateAndBrowseNodes(t *testing.T) {
+	ts, sM := newTestServer(t, "../test/api/")
+
+	var topic Node
+	if code := request(t, http.MethodPost, ts.URL+"/api/v1/topics", NewNode{Short: "Topic", Long: "detail"}, &topic); code != http.StatusCreated {
+		t.Fatal("failed to create topic:", code)
+	}
+	var reply Node
+	code := request(t, http.MethodPost, ts.URL+"/api/v1/nodes", NewNode{Parent: topic.ID, Short: "Reply", Indicator: 3}, &reply)
+	if code != http.StatusCreated || reply.Parent != topic.ID {
+		t.Fatal("failed to create reply:", code)
+	}
+
+	var topics []Node
+	request(t, http.MethodGet, ts.URL+"/api/v1/topics", nil, &topics)
+	if len(topics) != 1 || topics[0].ID != topic.ID {
+		t.Fatal("unexpected topics:", topics)
+	}
+	topicHash, _ := hashFromBase64(topic.ID)
+	sM.StoreNode(storage.NewVoteNode(topicHash, 0, []byte("voter")))
+	var children Children
+	request(t, http.MethodGet, ts.URL+"/api/v1/nodes/"+topic.ID+"/children?order=newest", nil, &children)
+	if len(children.Nodes) != 1 || children.Nodes[0].Short != "Reply" || children.Nodes[0].Indicator != 3 || children.Truncated {
+		t.Fatal("unexpected children:", children)
+	}
+	var node Node
+	if code := request(t, http.MethodGet, ts.URL+"/api/v1/nodes/"+reply.ID, nil, &node); code != http.StatusOK || node.ID != reply.ID {
+		t.Fatal("node lookup failed:", code)
+	}
+	var status Status
+	request(t, http.MethodGet, ts.URL+"/api/v1/status", nil, &status)
+	if status.Topics != 1 || status.Network != nil {
+		t.Fatal("unexpected status:", status)
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	ts, _ := newTestServer(t, "../test/api-invalid/")
+
+	unknown := "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=="
+	if code := request(t, http.MethodGet, ts.URL+"/api/v1/nodes/"+unknown, nil, nil); code != http.StatusNotFound {
+		t.Fatal("expected not found, got", code)
+	}
+	if code := request(t, http.MethodGet, ts.URL+"/api/v1/nodes/invalid", nil, nil); code != http.StatusBadRequest {
+		t.Fatal("expected bad request, got", code)
+	}
+	if code := request(t, http.MethodPost, ts.URL+"/api/v1/nodes", NewNode{Parent: unknown, Short: "Reply"}, nil); code != http.StatusBadRequest {
+		t.Fatal("replies to unknown nodes should be refused, got", code)
+	}
+	var topic Node
+	request(t, http.MethodPost, ts.URL+"/api/v1/topics", NewNode{Short: "Topic"}, &topic)
+	if code := request(t, http.MethodPost, ts.URL+"/api/v1/nodes", NewNode{Parent: topic.ID, Short: "Reply", Indicator: -1}, nil); code != http.StatusBadRequest {
+		t.Fatal("indicators below 0 should be refused, got", code)
+	}
+	if code := request(t, http.MethodGet, ts.URL+"/api/v1/nodes/"+topic.ID+"/children?order=invalid", nil, nil); code != http.StatusBadRequest {
+		t.Fatal("unknown orders should be refused, got", code)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ts, _ := newTestServer(t, "../test/api-auth/")
+
+	resp, err := http.Get(ts.URL + "/api/v1/topics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal("requests without token should be refused")
+	}
+	resp, err = http.Get(ts.URL + "/api/v1/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var description map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&description); err != nil || description["openapi"] == nil {
+		t.Fatal("invalid OpenAPI description:", err)
+	}
+}
+
+func TestLoopbackOnly(t *testing.T) {
+	s := NewServer(nil, nil, testToken)
+	if err := s.Start("0.0.0.0:0"); err != errNotLoopback {
+		t.Fatal("the API should only listen on loopback addresses")
+	}
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"dforum-app/configuration"
+	"dforum-app/security"
+	"dforum-app/storage"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	eventBufferSize   = 64 // Events queued for a slow client before new ones are dropped
+	heartbeatInterval = 30 * time.Second
+	// Max number of ancestors walked up to match a subtree filter
+	maxSubtreeDepth = 256
+)
+
+// Nodes a client subscribed to, every node is sent if no filter is set
+type eventFilter struct {
+	parent  *security.HashSignature // Direct replies to a node
+	subtree *security.HashSignature // Any descendant of a node
+}
+
+type eventSubscriber struct {
+	filter  eventFilter
+	events  chan Node
+	dropped int
+}
+
+// The event hub receives new nodes from storage and forwards them to the
+// clients of the event stream whose filters match.
+type eventHub struct {
+	sync.Mutex
+	storageModule *storage.StorageModule
+	subscribers   map[*eventSubscriber]struct{}
+}
+
+func newEventHub(sm *storage.StorageModule) *eventHub {
+	h := &eventHub{
+		storageModule: sm,
+		subscribers:   make(map[*eventSubscriber]struct{}),
+	}
+	if sm != nil {
+		sm.Subscribe(h)
+	}
+	return h
+}
+
+// Called by storage for every new node, must not block
+func (h *eventHub) RegisterNewNode(n *storage.Node) {
+	if n == nil || n.IsVote() {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	if len(h.subscribers) == 0 {
+		return
+	}
+	node := convertNode(n)
+	node.ContextLoading = h.storageModule.IsOrphan(n)
+	for sub := range h.subscribers {
+		if !h.matches(sub.filter, n) {
+			continue
+		}
+		select {
+		case sub.events <- node:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+func (h *eventHub) subscribe(filter eventFilter) *eventSubscriber {
+	h.Lock()
+	defer h.Unlock()
+	sub := &eventSubscriber{filter: filter, events: make(chan Node, eventBufferSize)}
+	h.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (h *eventHub) unsubscribe(sub *eventSubscriber) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.subscribers, sub)
+	if sub.dropped > 0 {
+		configuration.Logger.Infof("event stream client missed %d events", sub.dropped)
+	}
+}
+
+func (h *eventHub) matches(filter eventFilter, n *storage.Node) bool {
+	if filter.parent != nil && n.DatObj.Parent != *filter.parent {
+		return false
+	}
+	if filter.subtree != nil {
+		return h.isDescendant(n, *filter.subtree)
+	}
+	return true
+}
+
+// Walk up the ancestors of a node looking for a given node
+func (h *eventHub) isDescendant(n *storage.Node, ancestor security.HashSignature) bool {
+	for i := 0; i < maxSubtreeDepth; i++ {
+		parent := n.DatObj.Parent
+		if parent == ancestor {
+			return true
+		}
+		if parent == (security.HashSignature{}) {
+			return false
+		}
+		if n = h.storageModule.GetNode(parent, false); n == nil {
+			return false
+		}
+	}
+	return false
+}
+
+// Stream new nodes as Server-Sent Events, optionally filtered
+// with the parent or subtree query parameters.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	filter := eventFilter{}
+	for name, target := range map[string]**security.HashSignature{"parent": &filter.parent, "subtree": &filter.subtree} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		hash, ok := hashFromBase64(v)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid "+name+" ID")
+			return
+		}
+		*target = &hash
+	}
+
+	sub := s.events.subscribe(filter)
+	defer s.events.unsubscribe(sub)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case node := <-sub.events:
+			data, _ := json.Marshal(node)
+			fmt.Fprintf(w, "id: %s\nevent: new_node\ndata: %s\n\n", node.ID, data)
+		}
+		flusher.Flush()
+	}
+}
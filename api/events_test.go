@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bufio"
+	"dforum-app/storage"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Open an event stream and return the nodes received on it
+func streamEvents(t *testing.T, url string) <-chan Node {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("failed to open event stream:", resp.StatusCode)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	nodes := make(chan Node, 16)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data := strings.TrimPrefix(scanner.Text(), "data: "); data != scanner.Text() {
+				var n Node
+				json.Unmarshal([]byte(data), &n)
+				nodes <- n
+			}
+		}
+	}()
+	return nodes
+}
+
+func expectEvents(t *testing.T, name string, nodes <-chan Node, expected ...string) {
+	for _, short := range expected {
+		select {
+		case n := <-nodes:
+			if n.Short != short {
+				t.Fatalf("%s: expected %s, received %s", name, short, n.Short)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: %s was not received", name, short)
+		}
+	}
+	select {
+	case n := <-nodes:
+		t.Fatalf("%s: unexpected event %s", name, n.Short)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEventFilters(t *testing.T) {
+	ts, sM := newTestServer(t, "../test/api-events/")
+	topic := storage.NewNode("Topic", "", -1, [28]byte{})
+	other := storage.NewNode("Other", "", -1, [28]byte{})
+	sM.StoreNode(topic)
+	sM.StoreNode(other)
+	topicID := convertNode(topic).ID
+
+	firehose := streamEvents(t, ts.URL+"/api/v1/events")
+	parent := streamEvents(t, ts.URL+"/api/v1/events?parent="+topicID)
+	subtree := streamEvents(t, ts.URL+"/api/v1/events?subtree="+topicID)
+
+	reply := storage.NewNode("Reply", "", 0, topic.GetFingerprint())
+	sM.StoreAndRegisterNewNode(reply)
+	sM.StoreAndRegisterNewNode(storage.NewNode("Nested", "", 0, reply.GetFingerprint()))
+	sM.StoreAndRegisterNewNode(storage.NewNode("Elsewhere", "", 0, other.GetFingerprint()))
+
+	expectEvents(t, "firehose", firehose, "Reply", "Nested", "Elsewhere")
+	expectEvents(t, "parent", parent, "Reply")
+	expectEvents(t, "subtree", subtree, "Reply", "Nested")
+}
+
+func TestEventStreamAuthentication(t *testing.T) {
+	ts, _ := newTestServer(t, "../test/api-events-auth/")
+
+	resp, err := http.Get(ts.URL + "/api/v1/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal("event streams without token should be refused")
+	}
+	resp, err = http.Get(ts.URL + "/api/v1/events?token=" + testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("the token should be accepted as a query parameter, got", resp.StatusCode)
+	}
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"dforum-app/render"
+	"dforum-app/security"
+	"dforum-app/storage"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultFeedEntries = 50
+	maxFeedEntries     = 200
+)
+
+// Atom 1.0 documents, see RFC 4287
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// RSS 2.0 documents
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	GUID        rssGUID  `xml:"guid"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+// Serves /feed.atom and /feed.rss for the whole forum or, with the root
+// query parameter, for the subtree of a node such as a topic.
+func (s *Server) handleFeed(atom bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		root := security.HashSignature{}
+		title := "dforum"
+		if v := r.URL.Query().Get("root"); v != "" {
+			hash, ok := hashFromBase64(v)
+			if !ok {
+				writeError(w, http.StatusBadRequest, "invalid root ID")
+				return
+			}
+			n := s.storageModule.GetNode(hash, false)
+			if n == nil {
+				writeError(w, http.StatusNotFound, "node not found")
+				return
+			}
+			root, title = hash, "dforum - "+n.DatObj.Topic
+		}
+		limit := defaultFeedEntries
+		if v := r.URL.Query().Get("limit"); v != "" {
+			l, err := strconv.Atoi(v)
+			if err != nil || l <= 0 {
+				writeError(w, http.StatusBadRequest, "invalid limit")
+				return
+			}
+			if l < maxFeedEntries {
+				limit = l
+			} else {
+				limit = maxFeedEntries
+			}
+		}
+
+		nodes := s.getFeedNodes(root, limit)
+		base := "http://" + r.Host + apiPrefix
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Write([]byte(xml.Header))
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if atom {
+			encoder.Encode(newAtomFeed(title, encodeHash(root), base, nodes))
+		} else {
+			encoder.Encode(newRSSFeed(title, base, nodes))
+		}
+	}
+}
+
+// Most recent descendants of a node, newest first, found by walking the timestamp index
+// until enough of them are found. A zero root covers the whole forum, orphans excluded.
+func (s *Server) getFeedNodes(root security.HashSignature, limit int) []*storage.Node {
+	nodes := []*storage.Node{}
+	// Ancestors known to descend from the root or not, recent nodes often share them
+	descends := map[security.HashSignature]bool{}
+	s.storageModule.WalkNodesNewestFirst(func(id security.HashSignature) bool {
+		// Votes are counted in the results of their poll rather than listed
+		if n := s.storageModule.GetNode(id, false); n != nil && !n.IsVote() && s.descendsFrom(n, root, descends) {
+			nodes = append(nodes, n)
+		}
+		return len(nodes) < limit
+	})
+	return nodes
+}
+
+// Walk up the parents of a node until the root, a top level node or a missing ancestor is reached
+func (s *Server) descendsFrom(n *storage.Node, root security.HashSignature, known map[security.HashSignature]bool) bool {
+	visited := []security.HashSignature{}
+	result := false
+	for current := n; current != nil; {
+		parent := current.DatObj.Parent
+		if parent == root {
+			result = true
+			break
+		}
+		if r, ok := known[parent]; ok {
+			result = r
+			break
+		}
+		if parent == (security.HashSignature{}) {
+			break
+		}
+		visited = append(visited, parent)
+		current = s.storageModule.GetNode(parent, false)
+	}
+	for _, id := range visited {
+		known[id] = result
+	}
+	return result
+}
+
+func newAtomFeed(title string, root string, base string, nodes []*storage.Node) atomFeed {
+	self := base + "feed.atom?root=" + root
+	feed := atomFeed{
+		ID:      "urn:dforum:feed:" + root,
+		Title:   title,
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: self, Rel: "self"},
+		Entries: []atomEntry{},
+	}
+	if len(nodes) > 0 {
+		feed.Updated = formatTimestamp(nodes[0], time.RFC3339)
+	}
+	for _, n := range nodes {
+		id := encodeHash(n.GetFingerprint())
+		entry := atomEntry{
+			ID:      "urn:dforum:" + id,
+			Title:   n.DatObj.Topic,
+			Updated: formatTimestamp(n, time.RFC3339),
+			Link:    atomLink{Href: base + "nodes/" + id},
+			Content: atomContent{Type: "text", Body: n.DatObj.Content},
+		}
+		if term, label, ok := indicatorCategory(n); ok {
+			entry.Categories = []atomCategory{{Term: term, Label: label}}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+func newRSSFeed(title string, base string, nodes []*storage.Node) rssFeed {
+	channel := rssChannel{
+		Title:       title,
+		Link:        base + "topics",
+		Description: "Nodes of " + title,
+		Items:       []rssItem{},
+	}
+	if len(nodes) > 0 {
+		channel.LastBuildDate = formatTimestamp(nodes[0], time.RFC1123Z)
+	}
+	for _, n := range nodes {
+		id := encodeHash(n.GetFingerprint())
+		item := rssItem{
+			GUID:        rssGUID{ID: "urn:dforum:" + id},
+			Title:       n.DatObj.Topic,
+			Link:        base + "nodes/" + id,
+			Description: n.DatObj.Content,
+			PubDate:     formatTimestamp(n, time.RFC1123Z),
+		}
+		if _, label, ok := indicatorCategory(n); ok {
+			item.Categories = []string{label}
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	return rssFeed{Version: "2.0", Channel: channel}
+}
+
+// The agreement indicator of a reply as a category, topics having none
+func indicatorCategory(n *storage.Node) (string, string, bool) {
+	indicator := n.DatObj.Indicator
+	if indicator < 0 || indicator > 10 {
+		return "", "", false
+	}
+	return fmt.Sprintf("indicator-%d", indicator), fmt.Sprintf("%s (%d/10)", render.IndicatorText(indicator), indicator), true
+}
+
+func formatTimestamp(n *storage.Node, layout string) string {
+	return time.Unix(n.GetTimestamp(), 0).UTC().Format(layout)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"dforum-app/storage"
+	"encoding/xml"
+	"net/http"
+	"testing"
+)
+
+func getFeed(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal("invalid feed:", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestFeeds(t *testing.T) {
+	ts, sM := newTestServer(t, "../test/api-feed/")
+	topic := storage.NewNode("Topic", "", -1, [28]byte{})
+	reply := storage.NewNode("Reply", "content", 8, topic.GetFingerprint())
+	nested := storage.NewNode("Nested", "", 2, reply.GetFingerprint())
+	other := storage.NewNode("Other", "", -1, [28]byte{})
+	orphan := storage.NewNode("Orphan", "", 5, [28]byte{2})
+	for _, n := range []*storage.Node{topic, reply, nested, other, orphan} {
+		sM.StoreNode(n)
+	}
+
+	var atom atomFeed
+	if code := getFeed(t, ts.URL+"/api/v1/feed.atom?token="+testToken+"&root="+encodeHash(topic.GetFingerprint()), &atom); code != http.StatusOK {
+		t.Fatal("failed to get the topic feed:", code)
+	}
+	if len(atom.Entries) != 2 || atom.Title != "dforum - Topic" {
+		t.Fatal("the topic feed should contain its subtree:", atom)
+	}
+	for _, e := range atom.Entries {
+		if e.Title == "Reply" && (len(e.Categories) != 1 || e.Categories[0].Term != "indicator-8" ||
+			e.Link.Href != ts.URL+"/api/v1/nodes/"+encodeHash(reply.GetFingerprint())) {
+			t.Fatal("unexpected entry:", e)
+		}
+	}
+
+	var rss rssFeed
+	if code := getFeed(t, ts.URL+"/api/v1/feed.rss?limit=3&token="+testToken, &rss); code != http.StatusOK {
+		t.Fatal("failed to get the forum feed:", code)
+	}
+	if len(rss.Channel.Items) != 3 {
+		t.Fatal("the forum feed should be limited to 3 items:", rss.Channel.Items)
+	}
+	rss = rssFeed{}
+	getFeed(t, ts.URL+"/api/v1/feed.rss?token="+testToken, &rss)
+	if len(rss.Channel.Items) != 4 {
+		t.Fatal("the forum feed should list the nodes reachable from top level nodes:", rss.Channel.Items)
+	}
+
+	if code := getFeed(t, ts.URL+"/api/v1/feed.rss?token="+testToken+"&root="+encodeHash([28]byte{1}), &rss); code != http.StatusNotFound {
+		t.Fatal("feeds of unknown nodes should not be found, got", code)
+	}
+}
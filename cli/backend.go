@@ -0,0 +1,264 @@
+// Package cli implements the command-line client, which either talks to a
+// running daemon or reads the database directly.
+package cli
+
+import (
+	"dforum-app/network"
+	"dforum-app/render"
+	"dforum-app/security"
+	"dforum-app/storage"
+	"encoding/base64"
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	errDaemonRequired = errors.New("this command requires a running daemon")
+	errNodeNotFound   = errors.New("node not found")
+	errInvalidID      = errors.New("invalid node ID")
+	// Indicators range from 0, completely disagreeing, to 10, 5 being neutral
+	errInvalidIndicator = errors.New("the indicator must be between 0 and 10")
+)
+
+type NodeInfo struct {
+	ID        string
+	Parent    string
+	Title     string
+	Content   string
+	Indicator int
+	Timestamp time.Time
+}
+
+type TreeNode struct {
+	NodeInfo
+	Children []*TreeNode
+}
+
+// Result of a database check
+type VerifyReport struct {
+	Checked      int
+	Invalid      []string // Nodes failing security verifications
+	Mismatched   []string // Nodes stored under another hash than their fingerprint
+	Unreadable   []string
+	Orphans      int // Nodes whose parent has not been received, not an error
+	Inconsistent bool
+}
+
+// Markdown or HTML rendering of a thread
+type Document string
+
+type ExportReport struct {
+	Path  string
+	Nodes int
+}
+
+// Operations available from the command line
+type Backend interface {
+	Topics() ([]NodeInfo, error)
+	Tree(id string, depth int) (*TreeNode, error)
+	Show(id string) (NodeInfo, error)
+	Post(parent string, title string, content string, indicator int) (string, error)
+	Sync() (int, error)
+	Peers() ([]network.PeerInfo, error)
+	VerifyDB() (VerifyReport, error)
+	Export(path string, root string) (ExportReport, error)
+	Import(path string) (storage.ImportReport, error)
+	Render(id string, format string) (Document, error)
+}
+
+// The local backend serves commands from the storage module.
+// Network commands are only available when a network module is set, in the daemon.
+type LocalBackend struct {
+	storageModule *storage.StorageModule
+	networkModule *network.NetworkModule
+}
+
+func NewLocalBackend(sm *storage.StorageModule, nm *network.NetworkModule) *LocalBackend {
+	return &LocalBackend{storageModule: sm, networkModule: nm}
+}
+
+func (b *LocalBackend) Topics() ([]NodeInfo, error) {
+	return nodesToInfos(b.storageModule.GetTopLevelNodes()), nil
+}
+
+// Get a node and its replies, down to the given depth, a negative depth being unlimited
+func (b *LocalBackend) Tree(id string, depth int) (*TreeNode, error) {
+	root, err := b.getNode(id)
+	if err != nil {
+		return nil, err
+	}
+	return b.buildTree(root, depth), nil
+}
+
+func (b *LocalBackend) Show(id string) (NodeInfo, error) {
+	n, err := b.getNode(id)
+	if err != nil {
+		return NodeInfo{}, err
+	}
+	return nodeToInfo(n), nil
+}
+
+func (b *LocalBackend) Post(parent string, title string, content string, indicator int) (string, error) {
+	if indicator < 0 || indicator > 10 {
+		return "", errInvalidIndicator
+	}
+	if b.networkModule == nil {
+		return "", errDaemonRequired
+	}
+	parentID := security.HashSignature{}
+	if parent != "" {
+		p, err := b.getNode(parent)
+		if err != nil {
+			return "", err
+		}
+		parentID = p.GetFingerprint()
+	}
+	n := storage.NewNode(title, content, int8(indicator), parentID)
+	if n == nil {
+		return "", errors.New("failed to create node")
+	}
+	b.storageModule.StoreAndRegisterNewNode(n)
+	return encodeID(n.GetFingerprint()), nil
+}
+
+func (b *LocalBackend) Sync() (int, error) {
+	if b.networkModule == nil {
+		return 0, errDaemonRequired
+	}
+	return b.networkModule.SyncNow(), nil
+}
+
+func (b *LocalBackend) Peers() ([]network.PeerInfo, error) {
+	if b.networkModule == nil {
+		return nil, errDaemonRequired
+	}
+	return b.networkModule.GetConnectedPeers(), nil
+}
+
+// Check every stored node against its fingerprint and signature
+func (b *LocalBackend) VerifyDB() (VerifyReport, error) {
+	report := VerifyReport{Invalid: []string{}, Mismatched: []string{}, Unreadable: []string{}}
+	for _, id := range b.storageModule.GetAllNodeIDs() {
+		report.Checked++
+		n := b.storageModule.GetNode(id, false)
+		switch {
+		case n == nil:
+			report.Unreadable = append(report.Unreadable, encodeID(id))
+		case n.GetFingerprint() != id:
+			report.Mismatched = append(report.Mismatched, encodeID(id))
+		case !n.Verify():
+			report.Invalid = append(report.Invalid, encodeID(id))
+		case b.storageModule.IsOrphan(n):
+			report.Orphans++
+		}
+	}
+	report.Inconsistent = len(report.Invalid)+len(report.Mismatched)+len(report.Unreadable) > 0
+	return report, nil
+}
+
+// Write all nodes, or the subtree of root if set, to an archive file
+func (b *LocalBackend) Export(path string, root string) (ExportReport, error) {
+	var rootID *security.HashSignature
+	if root != "" {
+		n, err := b.getNode(root)
+		if err != nil {
+			return ExportReport{}, err
+		}
+		id := security.HashSignature(n.GetFingerprint())
+		rootID = &id
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return ExportReport{}, err
+	}
+	count, err := b.storageModule.ExportArchive(f, rootID)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return ExportReport{Path: path, Nodes: count}, err
+}
+
+func (b *LocalBackend) Import(path string) (storage.ImportReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return storage.ImportReport{}, err
+	}
+	defer f.Close()
+	return b.storageModule.ImportArchive(f)
+}
+
+func (b *LocalBackend) Render(id string, format string) (Document, error) {
+	root, err := b.getNode(id)
+	if err != nil {
+		return "", err
+	}
+	thread := b.storageModule.GetThread(root.GetFingerprint(), render.MaxDepth, render.MaxNodes, storage.OrderOldest, 0)
+	document := &strings.Builder{}
+	if err := render.RenderThread(document, thread, render.Format(format)); err != nil {
+		return "", err
+	}
+	return Document(document.String()), nil
+}
+
+func (b *LocalBackend) getNode(id string) (*storage.Node, error) {
+	hash, ok := decodeID(id)
+	if !ok {
+		return nil, errInvalidID
+	}
+	n := b.storageModule.GetNode(hash, false)
+	if n == nil {
+		return nil, errNodeNotFound
+	}
+	return n, nil
+}
+
+func (b *LocalBackend) buildTree(n *storage.Node, depth int) *TreeNode {
+	tree := &TreeNode{NodeInfo: nodeToInfo(n), Children: []*TreeNode{}}
+	if depth == 0 {
+		return tree
+	}
+	for _, child := range b.storageModule.GetSortedChildrenNodes(n.GetFingerprint(), storage.OrderOldest, 0, math.MaxInt8) {
+		tree.Children = append(tree.Children, b.buildTree(child, depth-1))
+	}
+	return tree
+}
+
+func nodesToInfos(nodes []*storage.Node) []NodeInfo {
+	infos := []NodeInfo{}
+	for _, n := range nodes {
+		if n != nil {
+			infos = append(infos, nodeToInfo(n))
+		}
+	}
+	return infos
+}
+
+func nodeToInfo(n *storage.Node) NodeInfo {
+	info := NodeInfo{
+		ID:        encodeID(n.GetFingerprint()),
+		Title:     n.DatObj.Topic,
+		Content:   n.DatObj.Content,
+		Indicator: int(n.DatObj.Indicator),
+		Timestamp: time.Unix(n.GetTimestamp(), 0),
+	}
+	if n.DatObj.Parent != (security.HashSignature{}) {
+		info.Parent = encodeID(n.DatObj.Parent)
+	}
+	return info
+}
+
+// IDs use the same base64 encoding as the GUI
+func encodeID(id security.HashSignature) string {
+	return base64.URLEncoding.EncodeToString(id[:])
+}
+
+func decodeID(id string) (security.HashSignature, bool) {
+	hash, err := base64.URLEncoding.DecodeString(id)
+	if err != nil || len(hash) != len(security.HashSignature{}) {
+		return security.HashSignature{}, false
+	}
+	return *(*[28]byte)(hash), true
+}
@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"dforum-app/configuration"
+	"dforum-app/network"
+	"dforum-app/storage"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var errUsage = errors.New("invalid usage")
+
+const usage = `usage: dforum [-json] <command> [arguments]
+
+commands:
+  topics                                   list top level nodes
+  tree [-depth n] <id>                     show a node and its replies
+  show <id>                                show a node
+  post [-parent id] [-indicator n] <title> [content]
+                                           create a node, requires a running daemon
+  sync                                     sync with connected peers, requires a running daemon
+  peers                                    list connected peers, requires a running daemon
+  verify-db                                check the nodes stored in the database
+  export [-root id] <file>                 write all nodes, or the subtree of a node, to an archive
+  import <file>                            verify and store the nodes of an archive,
+                                           requires a running daemon or no running GUI
+  render [-format markdown|html] <id>      print a thread as a Markdown or HTML document
+`
+
+// Run the command line client, returning its exit code.
+// Commands are sent to the running daemon if any, the database is opened read-only otherwise.
+func Run(args []string, out io.Writer, errOut io.Writer) int {
+	flags := flag.NewFlagSet("dforum", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.Usage = func() { fmt.Fprint(errOut, usage) }
+	asJSON := flags.Bool("json", false, "print results as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var backend Backend
+	if remote, err := DialControl(configuration.GetControlSocket()); err == nil {
+		defer remote.Close()
+		backend = remote
+	} else {
+		openStorage := storage.NewReadOnlyStorageModule
+		if flags.Arg(0) == "import" {
+			// Nothing else may use the database while it is written
+			openStorage = storage.OpenStorageModule
+		}
+		sm, err := openStorage(configuration.GetDatabasePath())
+		if err != nil {
+			fmt.Fprintln(errOut, "could not open the database, is the GUI running?", err)
+			return 1
+		}
+		defer sm.TearDown()
+		backend = NewLocalBackend(sm, nil)
+	}
+
+	if err := Execute(backend, flags.Args(), out, *asJSON); err != nil {
+		if err == errUsage {
+			fmt.Fprint(errOut, usage)
+			return 2
+		}
+		fmt.Fprintln(errOut, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// Execute a command on a backend and print its result
+func Execute(b Backend, args []string, out io.Writer, asJSON bool) error {
+	command, args := args[0], args[1:]
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	depth := flags.Int("depth", -1, "max depth of replies, unlimited by default")
+	parent := flags.String("parent", "", "ID of the node replied to, a new topic if empty")
+	indicator := flags.Int("indicator", 0, "agreement with the parent from 0 to 10, 5 being neutral")
+	root := flags.String("root", "", "ID of the exported subtree, every node if empty")
+	format := flags.String("format", "markdown", "format of rendered documents")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	args = flags.Args()
+
+	var result interface{}
+	var err error
+	switch {
+	case command == "topics" && len(args) == 0:
+		result, err = b.Topics()
+	case command == "tree" && len(args) == 1:
+		result, err = b.Tree(args[0], *depth)
+	case command == "show" && len(args) == 1:
+		result, err = b.Show(args[0])
+	case command == "post" && (len(args) == 1 || len(args) == 2):
+		content := ""
+		if len(args) == 2 {
+			content = args[1]
+		}
+		result, err = b.Post(*parent, args[0], content, *indicator)
+	case command == "sync" && len(args) == 0:
+		result, err = b.Sync()
+	case command == "peers" && len(args) == 0:
+		result, err = b.Peers()
+	case command == "verify-db" && len(args) == 0:
+		result, err = b.VerifyDB()
+	case command == "render" && len(args) == 1:
+		result, err = b.Render(args[0], *format)
+	case (command == "export" || command == "import") && len(args) == 1:
+		// Files may be opened by the daemon, in another working directory
+		path, absErr := filepath.Abs(args[0])
+		if absErr != nil {
+			return absErr
+		}
+		if command == "export" {
+			result, err = b.Export(path, *root)
+		} else {
+			result, err = b.Import(path)
+		}
+	default:
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(result)
+	} else {
+		printText(out, result)
+	}
+	if report, ok := result.(VerifyReport); ok && report.Inconsistent {
+		return errors.New("the database is inconsistent")
+	}
+	if report, ok := result.(storage.ImportReport); ok && report.Invalid > 0 {
+		return errors.New("the archive contains invalid nodes")
+	}
+	return err
+}
+
+func printText(out io.Writer, result interface{}) {
+	switch v := result.(type) {
+	case []NodeInfo:
+		for _, n := range v {
+			fmt.Fprintf(out, "%s  %s\n", n.ID, n.Title)
+		}
+	case *TreeNode:
+		printTree(out, v, 0)
+	case NodeInfo:
+		fmt.Fprintf(out, "ID:        %s\n", v.ID)
+		if v.Parent != "" {
+			fmt.Fprintf(out, "Parent:    %s\n", v.Parent)
+		}
+		fmt.Fprintf(out, "Date:      %s\n", v.Timestamp.Format(time.RFC822Z))
+		fmt.Fprintf(out, "Indicator: %d\n", v.Indicator)
+		fmt.Fprintf(out, "Title:     %s\n\n%s\n", v.Title, v.Content)
+	case string: // ID of a new node
+		fmt.Fprintln(out, v)
+	case int:
+		fmt.Fprintf(out, "synced with %d peers\n", v)
+	case VerifyReport:
+		fmt.Fprintf(out, "checked %d nodes: %d invalid, %d mismatched, %d unreadable, %d orphans\n",
+			v.Checked, len(v.Invalid), len(v.Mismatched), len(v.Unreadable), v.Orphans)
+		for _, id := range v.Invalid {
+			fmt.Fprintln(out, "invalid:", id)
+		}
+		for _, id := range v.Mismatched {
+			fmt.Fprintln(out, "mismatched:", id)
+		}
+		for _, id := range v.Unreadable {
+			fmt.Fprintln(out, "unreadable:", id)
+		}
+	case Document:
+		fmt.Fprint(out, v)
+	case ExportReport:
+		fmt.Fprintf(out, "exported %d nodes to %s\n", v.Nodes, v.Path)
+	case storage.ImportReport:
+		fmt.Fprintf(out, "imported %d nodes, %d already stored, %d invalid\n", v.Imported, v.Existing, v.Invalid)
+	case []network.PeerInfo:
+		for _, p := range v {
+			fmt.Fprintf(out, "%s  %.1f  %s\n", p.ID, p.Score, strings.Join(p.Addrs, " "))
+		}
+	}
+}
+
+func printTree(out io.Writer, t *TreeNode, level int) {
+	fmt.Fprintf(out, "%s%s  %s\n", strings.Repeat("  ", level), t.ID, t.Title)
+	for _, child := range t.Children {
+		printTree(out, child, level+1)
+	}
+}
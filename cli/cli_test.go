@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"bytes"
+	"dforum-app/storage"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Create a database with a topic, a reply and a tampered node
+func createTestDatabase(t *testing.T, path string) (*storage.Node, *storage.Node) {
+	previous := viper.Get("security.proofofwork-level")
+	viper.Set("security.proofofwork-level", 16)
+	t.Cleanup(func() { viper.Set("security.proofofwork-level", previous) })
+	os.RemoveAll(path)
+	sM := storage.NewStorageModule(path)
+	defer sM.TearDown()
+	topic := storage.NewNode("Topic", "detail", 0, [28]byte{})
+	reply := storage.NewNode("Reply", "content", 5, topic.GetFingerprint())
+	tampered := storage.NewNode("Tampered", "content", 0, topic.GetFingerprint())
+	tampered.DatObj.Content = "changed"
+	sM.StoreNode(topic)
+	sM.StoreNode(reply)
+	sM.StoreNode(tampered)
+	return topic, reply
+}
+
+func TestReadOnlyCommands(t *testing.T) {
+	path := "../test/cli/"
+	topic, reply := createTestDatabase(t, path)
+	// Databases only some versions create should not be needed to read the nodes
+	for _, optional := range []string{"datawants.db", "dataorphans.db", "peerbans.db", "peerbook.db"} {
+		os.RemoveAll(path + optional)
+	}
+	sM, err := storage.NewReadOnlyStorageModule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sM.TearDown()
+	b := NewLocalBackend(sM, nil)
+
+	out := &bytes.Buffer{}
+	if err := Execute(b, []string{"topics"}, out, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), encodeID(topic.GetFingerprint())+"  Topic") {
+		t.Fatal("unexpected topics output:", out.String())
+	}
+
+	out.Reset()
+	if err := Execute(b, []string{"tree", encodeID(topic.GetFingerprint())}, out, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "  "+encodeID(reply.GetFingerprint())+"  Reply") {
+		t.Fatal("reply should be indented below its topic:", out.String())
+	}
+
+	out.Reset()
+	if err := Execute(b, []string{"show", encodeID(reply.GetFingerprint())}, out, true); err != nil {
+		t.Fatal(err)
+	}
+	var info NodeInfo
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "Reply" || info.Parent != encodeID(topic.GetFingerprint()) || info.Indicator != 5 {
+		t.Fatal("unexpected node:", info)
+	}
+
+	if err := Execute(b, []string{"post", "Title"}, out, false); err != errDaemonRequired {
+		t.Fatal("posting should require a daemon")
+	}
+	if err := Execute(b, []string{"show"}, out, false); err != errUsage {
+		t.Fatal("missing arguments should be reported")
+	}
+}
+
+func TestVerifyDB(t *testing.T) {
+	path := "../test/cli-verify/"
+	createTestDatabase(t, path)
+	sM, err := storage.NewReadOnlyStorageModule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sM.TearDown()
+
+	report, _ := NewLocalBackend(sM, nil).VerifyDB()
+	if report.Checked != 3 || len(report.Invalid) != 1 || !report.Inconsistent {
+		t.Fatal("unexpected report:", report)
+	}
+	if err := Execute(NewLocalBackend(sM, nil), []string{"verify-db"}, &bytes.Buffer{}, false); err == nil {
+		t.Fatal("an inconsistent database should be reported")
+	}
+}
+
+func TestControlSocket(t *testing.T) {
+	path := "../test/cli-control/"
+	topic, _ := createTestDatabase(t, path)
+	sM := storage.NewStorageModule(path)
+	defer sM.TearDown()
+
+	l, err := ServeControl(path+"control.sock", NewLocalBackend(sM, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := ServeControl(path+"control.sock", NewLocalBackend(sM, nil)); err == nil {
+		t.Fatal("the socket of a running daemon should not be taken over")
+	}
+	remote, err := DialControl(path + "control.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	topics, err := remote.Topics()
+	if err != nil || len(topics) != 1 || topics[0].ID != encodeID(topic.GetFingerprint()) {
+		t.Fatal("unexpected topics:", topics, err)
+	}
+	sM.StoreNode(storage.NewVoteNode(topic.GetFingerprint(), 0, []byte("voter")))
+	tree, err := remote.Tree(topics[0].ID, 1)
+	if err != nil || len(tree.Children) != 2 {
+		t.Fatal("unexpected tree:", tree, err)
+	}
+	if _, err := remote.Show("invalid"); err == nil || err.Error() != errInvalidID.Error() {
+		t.Fatal("errors of the daemon should be forwarded:", err)
+	}
+	if _, err := remote.Post("", "Topic", "", 11); err == nil || err.Error() != errInvalidIndicator.Error() {
+		t.Fatal("indicators above 10 should be rejected:", err)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	path := "../test/cli-archive/"
+	topic, _ := createTestDatabase(t, path)
+	sM, err := storage.NewReadOnlyStorageModule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sM.TearDown()
+	b := NewLocalBackend(sM, nil)
+
+	out := &bytes.Buffer{}
+	archive := path + "topic.archive"
+	if err := Execute(b, []string{"export", "-root", encodeID(topic.GetFingerprint()), archive}, out, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "exported 3 nodes") {
+		t.Fatal("unexpected export output:", out.String())
+	}
+	if err := Execute(b, []string{"import", archive}, out, false); err != storage.ErrReadOnly {
+		t.Fatal("read-only databases should refuse imports:", err)
+	}
+
+	os.RemoveAll(path + "imported/")
+	imported := storage.NewStorageModule(path + "imported/")
+	defer imported.TearDown()
+	out.Reset()
+	if err := Execute(NewLocalBackend(imported, nil), []string{"import", archive}, out, false); err == nil {
+		t.Fatal("the tampered node should be reported")
+	}
+	if out.String() != "imported 2 nodes, 0 already stored, 1 invalid\n" {
+		t.Fatal("unexpected import output:", out.String())
+	}
+}
@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"dforum-app/configuration"
+	"dforum-app/network"
+	"dforum-app/storage"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+)
+
+const controlServiceName = "Control"
+
+type TreeArgs struct {
+	ID    string
+	Depth int
+}
+
+type PostArgs struct {
+	Parent    string
+	Title     string
+	Content   string
+	Indicator int
+}
+
+type ExportArgs struct {
+	Path string
+	Root string
+}
+
+type RenderArgs struct {
+	ID     string
+	Format string
+}
+
+// JSON-RPC service exposing a backend on the control socket of the daemon
+type ControlService struct {
+	backend Backend
+}
+
+func (c *ControlService) Topics(_ struct{}, reply *[]NodeInfo) (err error) {
+	*reply, err = c.backend.Topics()
+	return err
+}
+
+func (c *ControlService) Tree(args TreeArgs, reply *TreeNode) error {
+	tree, err := c.backend.Tree(args.ID, args.Depth)
+	if err != nil {
+		return err
+	}
+	*reply = *tree
+	return nil
+}
+
+func (c *ControlService) Show(id string, reply *NodeInfo) (err error) {
+	*reply, err = c.backend.Show(id)
+	return err
+}
+
+func (c *ControlService) Post(args PostArgs, reply *string) (err error) {
+	*reply, err = c.backend.Post(args.Parent, args.Title, args.Content, args.Indicator)
+	return err
+}
+
+func (c *ControlService) Sync(_ struct{}, reply *int) (err error) {
+	*reply, err = c.backend.Sync()
+	return err
+}
+
+func (c *ControlService) Peers(_ struct{}, reply *[]network.PeerInfo) (err error) {
+	*reply, err = c.backend.Peers()
+	return err
+}
+
+func (c *ControlService) VerifyDB(_ struct{}, reply *VerifyReport) (err error) {
+	*reply, err = c.backend.VerifyDB()
+	return err
+}
+
+func (c *ControlService) Export(args ExportArgs, reply *ExportReport) (err error) {
+	*reply, err = c.backend.Export(args.Path, args.Root)
+	return err
+}
+
+func (c *ControlService) Import(path string, reply *storage.ImportReport) (err error) {
+	*reply, err = c.backend.Import(path)
+	return err
+}
+
+func (c *ControlService) Render(args RenderArgs, reply *Document) (err error) {
+	*reply, err = c.backend.Render(args.ID, args.Format)
+	return err
+}
+
+// Serve a backend on a unix socket until the returned listener is closed.
+// Fails if another process is accepting commands on the socket.
+func ServeControl(path string, b Backend) (net.Listener, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName(controlServiceName, &ControlService{backend: b}); err != nil {
+		return nil, err
+	}
+	// A socket that answers belongs to a running daemon, one that does not was left over by a daemon that did not shut down cleanly
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already accepting commands on %s", path)
+	}
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	configuration.Logger.Info("accepting commands on:", path)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+	return l, nil
+}
+
+// The remote backend forwards commands to a running daemon
+type RemoteBackend struct {
+	client *rpc.Client
+}
+
+// Connect to the control socket of a running daemon
+func DialControl(path string) (*RemoteBackend, error) {
+	client, err := jsonrpc.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteBackend{client: client}, nil
+}
+
+func (r *RemoteBackend) Close() error {
+	return r.client.Close()
+}
+
+func (r *RemoteBackend) Topics() ([]NodeInfo, error) {
+	var reply []NodeInfo
+	return reply, r.call("Topics", struct{}{}, &reply)
+}
+
+func (r *RemoteBackend) Tree(id string, depth int) (*TreeNode, error) {
+	var reply TreeNode
+	if err := r.call("Tree", TreeArgs{ID: id, Depth: depth}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (r *RemoteBackend) Show(id string) (NodeInfo, error) {
+	var reply NodeInfo
+	return reply, r.call("Show", id, &reply)
+}
+
+func (r *RemoteBackend) Post(parent string, title string, content string, indicator int) (string, error) {
+	var reply string
+	return reply, r.call("Post", PostArgs{Parent: parent, Title: title, Content: content, Indicator: indicator}, &reply)
+}
+
+func (r *RemoteBackend) Sync() (int, error) {
+	var reply int
+	return reply, r.call("Sync", struct{}{}, &reply)
+}
+
+func (r *RemoteBackend) Peers() ([]network.PeerInfo, error) {
+	var reply []network.PeerInfo
+	return reply, r.call("Peers", struct{}{}, &reply)
+}
+
+func (r *RemoteBackend) VerifyDB() (VerifyReport, error) {
+	var reply VerifyReport
+	return reply, r.call("VerifyDB", struct{}{}, &reply)
+}
+
+// Paths are opened by the daemon, they must be absolute
+func (r *RemoteBackend) Export(path string, root string) (ExportReport, error) {
+	var reply ExportReport
+	return reply, r.call("Export", ExportArgs{Path: path, Root: root}, &reply)
+}
+
+func (r *RemoteBackend) Import(path string) (storage.ImportReport, error) {
+	var reply storage.ImportReport
+	return reply, r.call("Import", path, &reply)
+}
+
+func (r *RemoteBackend) Render(id string, format string) (Document, error) {
+	var reply Document
+	return reply, r.call("Render", RenderArgs{ID: id, Format: format}, &reply)
+}
+
+func (r *RemoteBackend) call(method string, args interface{}, reply interface{}) error {
+	return r.client.Call(controlServiceName+"."+method, args, reply)
+}
@@ -0,0 +1,16 @@
+// Command line client for posting, browsing and syncing without the GUI
+package main
+
+import (
+	"dforum-app/cli"
+	"dforum-app/configuration"
+	"os"
+)
+
+func main() {
+	// The config file in the working directory locates the database and the daemon
+	wd, _ := os.Getwd()
+	configuration.DisableLogging()
+	configuration.InitConfigs(wd)
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,32 @@
+// Headless node built without the GUI and its system dependencies,
+// used to run seeds and relays on servers and in containers.
+package main
+
+import (
+	"dforum-app/configuration"
+	"dforum-app/daemon"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	configPath := flag.String("config", "", "directory of the config file, the working directory by default")
+	pidFile := flag.String("pid-file", "dforum.pid", "file storing the process ID")
+	statusFile := flag.String("status-file", "dforum-status.json", "file storing the node status")
+	flag.Parse()
+
+	if *configPath == "" {
+		*configPath, _ = os.Getwd()
+	}
+	configuration.InitConfigs(*configPath)
+	logPath := *configPath + string(os.PathSeparator) + "dfd.log"
+	logFile, _ := os.Create(logPath)
+	logFile.Close() // Create a new empty file or truncate existing
+	configuration.InitLogger(logPath)
+
+	if err := daemon.Run(*pidFile, *statusFile); err != nil {
+		fmt.Fprintln(os.Stderr, "could not start daemon:", err)
+		os.Exit(1)
+	}
+}
@@ -3,6 +3,7 @@ package configuration
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -14,8 +15,65 @@ const (
 	networkSeedsKey   = "network.seeds"
 	networkPortKey    = "network.port"
 	networkPeersKey   = "network.peers"
+	transportsKey     = "network.transports"
+	websocketPortKey  = "network.websocket-port"
+	securityKey       = "network.security"
+	relayModeKey      = "network.relay.mode"
+	relayPeersKey     = "network.relay.peers"
+	holePunchingKey   = "network.holepunching"
+	syncIntervalKey   = "network.sync.interval"
+	syncFanoutKey     = "network.sync.fanout"
+	syncJitterKey     = "network.sync.jitter"
+	propagationKey    = "network.propagation"
+	mdnsKey           = "network.mdns"
+	networkKeyKey     = "network.private.key"
+	privateSeedsKey   = "network.private.seeds"
+	syncRateKey       = "network.limits.sync-rate"
+	syncBurstKey      = "network.limits.sync-burst"
+	invRateKey        = "network.limits.inventory-rate"
+	invBurstKey       = "network.limits.inventory-burst"
+	dataRateKey       = "network.limits.data-rate"
+	dataBurstKey      = "network.limits.data-burst"
+	chunkRateKey      = "network.limits.chunk-rate"
+	chunkBurstKey     = "network.limits.chunk-burst"
+	maxHandlersKey    = "network.limits.max-handlers"
 	dbPathKey         = "database.storage-path"
+	threadDepthKey    = "database.thread.max-depth"
+	threadNodesKey    = "database.thread.max-nodes"
+	attachmentSizeKey = "database.attachments.max-size"
+	controlSocketKey  = "daemon.control-socket"
+	apiEnabledKey     = "api.enabled"
+	apiAddressKey     = "api.address"
+	apiTokenKey       = "api.token"
 	powLevelKey       = "security.proofofwork-level"
+	remoteImagesKey   = "gui.remote-images"
+	voterSecretKey    = "security.voter-secret"
+)
+
+// Transports the host listens and dials on
+const (
+	TransportTCP       = "tcp"
+	TransportQUIC      = "quic"
+	TransportWebSocket = "ws"
+)
+
+// Protocols securing connections, in order of preference
+const (
+	SecurityTLS   = "tls"
+	SecurityNoise = "noise"
+)
+
+// Roles of the host in circuit relays
+const (
+	RelayModeOff     = "off"
+	RelayModeClient  = "client"  // Reachable through relays when behind a NAT
+	RelayModeService = "service" // Relays connections for other peers, used by seeds
+)
+
+// Modes used to share new nodes with the network
+const (
+	PropagationDirect    = "direct"    // Inventory messages sent to every peer
+	PropagationGossipSub = "gossipsub" // Nodes published on libp2p gossipsub topics
 )
 
 var defaults = map[string]interface{}{
@@ -24,8 +82,39 @@ var defaults = map[string]interface{}{
 	networkPortKey:    6870,
 	networkSeedsKey:   []string{},
 	networkPeersKey:   []string{},
+	transportsKey:     []string{TransportTCP, TransportQUIC},
+	websocketPortKey:  6871,
+	securityKey:       []string{SecurityTLS, SecurityNoise},
+	relayModeKey:      RelayModeClient,
+	relayPeersKey:     []string{},
+	holePunchingKey:   true,
+	syncIntervalKey:   300, // seconds
+	syncFanoutKey:     3,
+	syncJitterKey:     30, // seconds
+	propagationKey:    PropagationDirect,
+	mdnsKey:           true,
+	networkKeyKey:     "",
+	privateSeedsKey:   []string{},
+	syncRateKey:       0.05, // requests per second from a single peer
+	syncBurstKey:      3,
+	invRateKey:        20.0,
+	invBurstKey:       100,
+	dataRateKey:       20.0,
+	dataBurstKey:      100,
+	chunkRateKey:      10.0,
+	chunkBurstKey:     64,
+	maxHandlersKey:    64,
 	dbPathKey:         "database" + string(os.PathSeparator),
+	threadDepthKey:    8,
+	threadNodesKey:    500,
+	attachmentSizeKey: 8 << 20, // bytes
+	controlSocketKey:  "dforum.sock",
+	apiEnabledKey:     false,
+	apiAddressKey:     "127.0.0.1:6880",
+	apiTokenKey:       "",
 	powLevelKey:       "24",
+	remoteImagesKey:   false,
+	voterSecretKey:    "",
 }
 
 func InitConfigs(configPath string) {
@@ -72,21 +161,173 @@ func GetDatabasePath() string {
 	return viper.GetString(dbPathKey)
 }
 
+// Max depth below the root and max number of nodes of threads fetched at once
+func GetThreadLimits() (int, int) {
+	return getPositiveInt(threadDepthKey), getPositiveInt(threadNodesKey)
+}
+
+// Max size in bytes of an attachment, larger attachments are neither created nor fetched
+func GetMaxAttachmentSize() int64 {
+	return int64(getPositiveInt(attachmentSizeKey))
+}
+
+// Unix socket on which a running daemon accepts commands from the CLI
+func GetControlSocket() string {
+	if v := viper.GetString(controlSocketKey); v != "" {
+		return v
+	}
+	return defaults[controlSocketKey].(string)
+}
+
+// Whether the local HTTP API is served
+func IsApiEnabled() bool {
+	return viper.GetBool(apiEnabledKey)
+}
+
+// Whether images of posts are loaded from remote hosts, which learn who reads them
+func AreRemoteImagesAllowed() bool {
+	return viper.GetBool(remoteImagesKey)
+}
+
+func GetApiAddress() string {
+	if v := viper.GetString(apiAddressKey); v != "" {
+		return v
+	}
+	return defaults[apiAddressKey].(string)
+}
+
+// Token clients of the HTTP API must present, a random one is generated if none is set
+func GetApiToken() string {
+	return viper.GetString(apiTokenKey)
+}
+
+func SetApiToken(token string) {
+	viper.Set(apiTokenKey, token)
+	viperSave()
+}
+
+// Secret the pseudonyms of the local voter are derived from, empty until the first vote
+func GetVoterSecret() string {
+	return viper.GetString(voterSecretKey)
+}
+
+func SetVoterSecret(secret string) {
+	viper.Set(voterSecretKey, secret)
+	viperSave()
+}
+
 func GetNetworkSeeds() []string {
 	return viper.GetStringSlice(networkSeedsKey)
 }
 
+// Peers saved by previous versions, known peers are now kept in the address book
 func GetNetworkPeers() []string {
 	return viper.GetStringSlice(networkPeersKey)
 }
 
-func SetNetworkPeers(peers []string) {
-	viper.Set(networkPeersKey, peers)
+func GetNetworkPort() int {
+	return viper.GetInt(networkPortKey)
+}
+
+// Transports enabled in the config, TCP is used if none is valid
+func GetTransports() []string {
+	transports := filterValues(viper.GetStringSlice(transportsKey), TransportTCP, TransportQUIC, TransportWebSocket)
+	if len(transports) == 0 {
+		return []string{TransportTCP}
+	}
+	return transports
+}
+
+// TCP port of the WebSocket transport, distinct from the TCP transport's port
+func GetWebSocketPort() int {
+	return viper.GetInt(websocketPortKey)
+}
+
+// Security protocols enabled in the config, in order of preference
+func GetSecurityProtocols() []string {
+	protocols := filterValues(viper.GetStringSlice(securityKey), SecurityTLS, SecurityNoise)
+	if len(protocols) == 0 {
+		return defaults[securityKey].([]string)
+	}
+	return protocols
+}
+
+func GetRelayMode() string {
+	switch mode := viper.GetString(relayModeKey); mode {
+	case RelayModeOff, RelayModeService:
+		return mode
+	}
+	return RelayModeClient
+}
+
+// Relays used when behind a NAT, the seeds are used if none are set
+func GetRelayPeers() []string {
+	return viper.GetStringSlice(relayPeersKey)
+}
+
+// Whether direct connections are attempted through NATs after connecting via a relay
+func IsHolePunchingEnabled() bool {
+	return viper.GetBool(holePunchingKey)
+}
+
+// Returns the interval between periodic syncs, the number of peers synced each time
+// and the maximum random delay added to each interval.
+func GetSyncSchedule() (time.Duration, int, time.Duration) {
+	return time.Duration(viper.GetInt(syncIntervalKey)) * time.Second,
+		viper.GetInt(syncFanoutKey),
+		time.Duration(viper.GetInt(syncJitterKey)) * time.Second
+}
+
+func GetPropagationMode() string {
+	if viper.GetString(propagationKey) == PropagationGossipSub {
+		return PropagationGossipSub
+	}
+	return PropagationDirect
+}
+
+// Whether peers on the local network are discovered with mDNS
+func IsMdnsEnabled() bool {
+	return viper.GetBool(mdnsKey)
+}
+
+// Hex encoded pre-shared key of a private forum, empty for the public network
+func GetNetworkKey() string {
+	return viper.GetString(networkKeyKey)
+}
+
+func SetNetworkKey(key string) {
+	viper.Set(networkKeyKey, key)
 	viperSave()
 }
 
-func GetNetworkPort() int {
-	return viper.GetInt(networkPortKey)
+// Seeds of the private forum, used instead of the public seeds when a network key is set
+func GetPrivateNetworkSeeds() []string {
+	return viper.GetStringSlice(privateSeedsKey)
+}
+
+// Rate, in requests per second, and burst of sync requests accepted from a peer
+func GetSyncRequestLimit() (float64, int) {
+	return getPositiveFloat(syncRateKey), getPositiveInt(syncBurstKey)
+}
+
+// Rate, in messages per second, and burst of inventory messages accepted from a peer
+func GetInventoryLimit() (float64, int) {
+	return getPositiveFloat(invRateKey), getPositiveInt(invBurstKey)
+}
+
+// Rate, in requests per second, and burst of data requests accepted from a peer
+func GetDataRequestLimit() (float64, int) {
+	return getPositiveFloat(dataRateKey), getPositiveInt(dataBurstKey)
+}
+
+// Rate, in requests per second, and burst of attachment chunk requests accepted from a peer
+func GetChunkRequestLimit() (float64, int) {
+	return getPositiveFloat(chunkRateKey), getPositiveInt(chunkBurstKey)
+}
+
+// Max number of inbound messages handled at the same time
+func GetMaxConcurrentHandlers() int {
+	return getPositiveInt(maxHandlersKey)
 }
 
 func GetJsonConfigs() map[string]interface{} {
@@ -103,6 +344,41 @@ func validateConfig() {
 	viperSave()
 }
 
+// Keep the known values of a list, logging and dropping the others
+func filterValues(values []string, known ...string) []string {
+	filtered := []string{}
+	for _, v := range values {
+		valid := false
+		for _, k := range known {
+			if v == k {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			Logger.Error("ignoring unknown config value:", v)
+			continue
+		}
+		filtered = append(filtered, v)
+	}
+	return filtered
+}
+
+// Get a config value that must be positive, using its default otherwise
+func getPositiveFloat(key string) float64 {
+	if v := viper.GetFloat64(key); v > 0 {
+		return v
+	}
+	return defaults[key].(float64)
+}
+
+func getPositiveInt(key string) int {
+	if v := viper.GetInt(key); v > 0 {
+		return v
+	}
+	return defaults[key].(int)
+}
+
 func viperSave() {
 	if err := viper.WriteConfig(); err != nil {
 		Logger.Error("could not save configs:", err.Error())
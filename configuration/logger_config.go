@@ -36,3 +36,8 @@ func InitLogger(logFilePath string) {
 	Logger = logger.Sugar()
 	defer Logger.Sync()
 }
+
+// Discard logs, used by the command line client to keep its output readable
+func DisableLogging() {
+	Logger = zap.NewNop().Sugar()
+}
@@ -0,0 +1,188 @@
+package daemon
+
+import (
+	"dforum-app/api"
+	"dforum-app/cli"
+	"dforum-app/configuration"
+	"dforum-app/network"
+	"dforum-app/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Delay between two updates of the status file
+const statusInterval = 30 * time.Second
+
+// State of a running daemon written to its status file
+type Status struct {
+	PID     int
+	Started time.Time
+	Updated time.Time
+	Network network.NetworkStatus
+}
+
+// The daemon runs the storage and network modules without the GUI,
+// letting seeds and relays run on servers and in containers.
+type Daemon struct {
+	storageModule *storage.StorageModule
+	networkModule *network.NetworkModule
+	control       net.Listener
+	apiServer     *api.Server
+	pidFile       string
+	statusFile    string
+	started       time.Time
+}
+
+// Files left empty are not written
+func NewDaemon(pidFile string, statusFile string) *Daemon {
+	return &Daemon{
+		pidFile:    pidFile,
+		statusFile: statusFile,
+	}
+}
+
+// Start the storage and network modules and write the PID file.
+// Fails if the PID file names a process that is still running, such as another daemon using the same database,
+// or if the database cannot be opened.
+func (d *Daemon) Start() error {
+	if d.pidFile != "" {
+		if pid, running := runningProcess(d.pidFile); running {
+			return fmt.Errorf("a daemon is already running with pid %d, see %s", pid, d.pidFile)
+		}
+		if err := ioutil.WriteFile(d.pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+	d.started = time.Now()
+	storageModule, err := storage.OpenStorageModule(configuration.GetDatabasePath())
+	if err != nil {
+		if d.pidFile != "" {
+			os.Remove(d.pidFile)
+		}
+		return fmt.Errorf("could not open the database: %w", err)
+	}
+	d.storageModule = storageModule
+	d.networkModule = network.NewNetworkModule(d.storageModule)
+	d.networkModule.CreateAndStartHost()
+	// Accept commands from the CLI
+	control, err := cli.ServeControl(configuration.GetControlSocket(), cli.NewLocalBackend(d.storageModule, d.networkModule))
+	if err != nil {
+		configuration.Logger.Error("could not open control socket:", err.Error())
+	}
+	d.control = control
+	d.apiServer = api.StartFromConfig(d.storageModule, d.networkModule)
+	d.writeStatus()
+	configuration.Logger.Info("daemon started with pid:", os.Getpid())
+	return nil
+}
+
+// Run until stop is closed, updating the status file periodically
+func (d *Daemon) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			d.writeStatus()
+		}
+	}
+}
+
+// Shut the modules down gracefully and remove the PID and status files
+func (d *Daemon) TearDown() {
+	configuration.Logger.Info("daemon shutting down")
+	if d.control != nil {
+		d.control.Close()
+	}
+	if d.apiServer != nil {
+		d.apiServer.Close()
+	}
+	d.networkModule.TearDown()
+	d.storageModule.TearDown()
+	for _, path := range []string{d.pidFile, d.statusFile} {
+		if path != "" {
+			os.Remove(path)
+		}
+	}
+}
+
+func (d *Daemon) GetStatus() Status {
+	return Status{
+		PID:     os.Getpid(),
+		Started: d.started,
+		Updated: time.Now(),
+		Network: d.networkModule.GetStatus(),
+	}
+}
+
+func (d *Daemon) writeStatus() {
+	if d.statusFile == "" {
+		return
+	}
+	statusBytes, err := json.MarshalIndent(d.GetStatus(), "", "  ")
+	if err != nil {
+		configuration.Logger.Error("could not convert daemon status to bytes")
+		return
+	}
+	// Write then rename so that readers never see a partial file
+	tmp := d.statusFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, statusBytes, 0644); err != nil {
+		configuration.Logger.Error("could not write status file:", err.Error())
+		return
+	}
+	if err := os.Rename(tmp, d.statusFile); err != nil {
+		configuration.Logger.Error("could not write status file:", err.Error())
+	}
+}
+
+// Run a daemon until SIGINT or SIGTERM is received
+func Run(pidFile string, statusFile string) error {
+	d := NewDaemon(pidFile, statusFile)
+	if err := d.Start(); err != nil {
+		return err
+	}
+	defer d.TearDown()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	stop := make(chan struct{})
+	go func() {
+		sig := <-signals
+		configuration.Logger.Info("received signal:", sig.String())
+		close(stop)
+	}()
+	d.Run(stop)
+	return nil
+}
+
+// Process recorded in a PID file, if it is still running
+func runningProcess(pidFile string) (int, bool) {
+	content, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	// A previous run may have had the same pid, such as in a restarted container
+	if err != nil || pid <= 0 || pid == os.Getpid() {
+		return 0, false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, false
+	}
+	// Signal 0 only checks the process exists, processes of other users cannot be signalled
+	err = process.Signal(syscall.Signal(0))
+	return pid, err == nil || errors.Is(err, syscall.EPERM)
+}
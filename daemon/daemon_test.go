@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestDaemonLifecycle(t *testing.T) {
+	path := "../test/daemon/"
+	os.RemoveAll(path)
+	os.MkdirAll(path, 0755)
+	viper.Set("database.storage-path", path)
+	viper.Set("network.port", 0)
+	defer viper.Set("database.storage-path", nil)
+
+	d := NewDaemon(path+"dforum.pid", path+"status.json")
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	pid, err := ioutil.ReadFile(path + "dforum.pid")
+	if err != nil || strings.TrimSpace(string(pid)) != strconv.Itoa(os.Getpid()) {
+		t.Fatal("unexpected pid file:", string(pid), err)
+	}
+	statusBytes, err := ioutil.ReadFile(path + "status.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status Status
+	if err := json.Unmarshal(statusBytes, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.PID != os.Getpid() || status.Network.PeerID == "" {
+		t.Fatal("unexpected status:", status)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	d.Run(stop)
+	d.TearDown()
+	for _, f := range []string{"dforum.pid", "status.json"} {
+		if _, err := os.Stat(path + f); !os.IsNotExist(err) {
+			t.Fatal("file not removed on shutdown:", f)
+		}
+	}
+}
+
+func TestDaemonRefusesRunningPid(t *testing.T) {
+	path := "../test/daemon-running/"
+	os.RemoveAll(path)
+	os.MkdirAll(path, 0755)
+	// The parent of the test process is alive
+	ioutil.WriteFile(path+"dforum.pid", []byte(strconv.Itoa(os.Getppid())+"\n"), 0644)
+	if err := NewDaemon(path+"dforum.pid", "").Start(); err == nil {
+		t.Fatal("daemon should not start while the recorded process runs")
+	}
+	if _, running := runningProcess(path + "missing.pid"); running {
+		t.Fatal("missing PID files should not name a running process")
+	}
+}
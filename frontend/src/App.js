@@ -7,55 +7,113 @@ import SettingsPage from './components/SettingsPage';
 import SearchPage from './components/SearchPage';
 import NewTopic from './components/NewTopic';
 import ViewedPage from './components/ViewedPage';
-import { addTopic, addNode, addNodes } from './util/DataHandler';
+import { addTopic, addNodes } from './util/DataHandler';
+import { onPostDone } from './util/Events';
 
 class App extends React.Component {
   state = {
     topics: [],
     data: {},
     inProgress: [],
+    order: "random",
+    // Nodes received before their parent, and the parents received since then
+    orphans: [],
+    orphanParents: {},
   }
 
-  newComment = (topic, detail, indicator, parent) => {
+  changeOrder = (order, then) => {
+    this.setState({...this.state, order: order}, then)
+  }
+
+  newComment = (topic, detail, indicator, parent, uploads = []) => {
     this.setState({...this.state, inProgress: [...this.state.inProgress, "comment"]})
-    window.backend.ViewHandler.CreateNode(topic, detail, parseInt(indicator), parent).then(() => {
+    const created = uploads.length > 0
+      ? this.newCommentWithAttachments(topic, detail, indicator, parent, uploads)
+      : window.backend.ViewHandler.CreateNode(topic, detail, parseInt(indicator), parent)
+    created.catch(e => console.error(e)).then(() => {
       this.state.inProgress.shift()
       this.setState({...this.state, inProgress: [...this.state.inProgress]})
     })
   }
 
+  // The proof of work of posts with attachments goes on in the backend once the call returns,
+  // the post is done when the event of the given ID arrives
+  newCommentWithAttachments = (topic, detail, indicator, parent, uploads) => {
+    const id = `${Date.now()}-${Math.random()}`
+    return new Promise((resolve, reject) => {
+      const unsubscribe = onPostDone(id, done => {
+        unsubscribe()
+        done.Error ? reject(done.Error) : resolve()
+      })
+      window.backend.ViewHandler.CreateNodeWithAttachments(id, topic, detail, parseInt(indicator), parent, uploads)
+        .catch(e => {
+          unsubscribe()
+          reject(e)
+        })
+    })
+  }
+
   componentDidMount() {
-    window.wails.Events.On('new_node', node => {
-      this.receiveNode(node)
+    window.wails.Events.On('new_nodes', nodes => {
+      this.receiveNodes(nodes)
+    })
+    window.wails.Events.On('new_orphans', orphans => {
+      this.receiveOrphans(orphans)
     })
+    window.wails.Events.On('orphans_resolved', parents => {
+      this.resolveOrphans(parents)
+    })
+    window.backend.ViewHandler.GetOrphans().then(this.receiveOrphans)
+  }
+
+  receiveOrphans = (orphans) => {
+    const known = new Set(this.state.orphans.map(o => o.ID))
+    this.setState({...this.state, orphans: [...this.state.orphans, ...orphans.filter(o => !known.has(o.ID))]})
+  }
+
+  resolveOrphans = (parents) => {
+    const orphanParents = Object.assign({}, this.state.orphanParents)
+    parents.forEach(p => { orphanParents[p.ID] = p })
+    this.setState({...this.state, orphanParents: orphanParents})
   }
 
   getParentNodes = () => {
-    window.backend.ViewHandler.GetAllTopics().then( res => {
+    window.backend.ViewHandler.GetAllTopics(this.state.order).then( res => {
       this.setState({...this.state, topics: res})
     })
   }
 
-  receiveNode = (node) => {
+  receiveNodes = (nodes) => {
     const newState = Object.assign({}, this.state.data);
-    addNode(node, newState)
+    addNodes(nodes, newState)
     this.setState({...this.state, data: newState})
   }
 
   registerChildren = (nodeID) => {
-    window.backend.ViewHandler.GetChildren(nodeID).then( children => {
+    window.backend.ViewHandler.GetChildren(nodeID, this.state.order).then( children => {
       const newState = Object.assign({}, this.state.data);
       addNodes(children, newState)
       this.setState({...this.state, data: newState})
     })
   }
 
+  // Fetch the discussion of a topic again, in the current order
+  reloadTopic = (topicID) => {
+    window.backend.ViewHandler.GetThread(topicID, 0, this.state.order).then( thread => {
+      const newState = Object.assign({}, this.state.data);
+      newState[topicID] = {...newState[topicID], Children: {}}
+      addNodes(thread.Nodes.slice(1), newState)
+      this.setState({...this.state, data: newState})
+    })
+  }
+
   registerTopic = (topic) => {
     if (!this.state.data[topic.ID]) {
-      window.backend.ViewHandler.GetChildren(topic.ID).then( children => {
+      // Fetch the whole discussion at once, parents come before their children
+      window.backend.ViewHandler.GetThread(topic.ID, 0, this.state.order).then( thread => {
         const newState = Object.assign({}, this.state.data);
         addTopic(topic, newState)
-        addNodes(children, newState)
+        addNodes(thread.Nodes.slice(1), newState)
         this.setState({...this.state, data: newState})
       })
     }
@@ -70,9 +128,12 @@ class App extends React.Component {
             <div className="container">
               <Routes>
                 <Route path="search" element={
-                  <SearchPage getTopics={this.getParentNodes} register={this.registerTopic} topics={this.state.topics}/>
+                  <SearchPage getTopics={this.getParentNodes} register={this.registerTopic} topics={this.state.topics}
+                    order={this.state.order} changeOrder={this.changeOrder}
+                    orphans={this.state.orphans} orphanParents={this.state.orphanParents}/>
                 } exact />
-                <Route path="search/:topicId" element={<Topic data={this.state.data} loadMore={this.registerChildren} newComment={this.newComment}/>} exact />
+                <Route path="search/:topicId" element={<Topic data={this.state.data} loadMore={this.registerChildren} newComment={this.newComment}
+                  order={this.state.order} changeOrder={this.changeOrder} reload={this.reloadTopic}/>} exact />
                 <Route path="new-topic" element={
                   <NewTopic/>
                 }/>
@@ -83,7 +144,9 @@ class App extends React.Component {
                   <ViewedPage topics={this.state.data}/>
                 }/>
                 <Route path="*" element={
-                  <SearchPage getTopics={this.getParentNodes} register={this.registerTopic} topics={this.state.topics}/>
+                  <SearchPage getTopics={this.getParentNodes} register={this.registerTopic} topics={this.state.topics}
+                    order={this.state.order} changeOrder={this.changeOrder}
+                    orphans={this.state.orphans} orphanParents={this.state.orphanParents}/>
                 }/>
               </Routes>
             </div>
@@ -0,0 +1,67 @@
+import React, { useState, useEffect } from 'react';
+import { formatSize, downloadDocument, base64ToBytes } from '../util/Util';
+import { onDownloadProgress } from '../util/Events';
+
+// Attachments are fetched from peers when requested, images show a thumbnail once stored
+function Attachments({ nodeId, attachments = [] }) {
+    if (attachments.length === 0) {
+        return null
+    }
+    return (
+        <ul className="list-unstyled mb-2">
+            { attachments.map(a => <Attachment key={a.Hash} nodeId={nodeId} attachment={a}/>) }
+        </ul>
+    );
+}
+
+function Attachment({ nodeId, attachment }) {
+    const [stored, setStored] = useState(attachment.Stored)
+    const [downloading, setDownloading] = useState(false)
+    const [error, setError] = useState("")
+    const [thumbnail, setThumbnail] = useState("")
+    const complete = stored === attachment.Chunks
+
+    useEffect(() => onDownloadProgress(attachment.Hash, progress => {
+        setStored(progress.Stored)
+        setDownloading(!progress.Done)
+        setError(progress.Error)
+    }), [attachment.Hash])
+
+    useEffect(() => {
+        if (complete && attachment.MediaType.startsWith("image/")) {
+            window.backend.ViewHandler.GetThumbnail(nodeId, attachment.Hash).then(setThumbnail).catch(() => {})
+        }
+    }, [complete, nodeId, attachment.Hash, attachment.MediaType])
+
+    const download = () => {
+        setError("")
+        setDownloading(true)
+        window.backend.ViewHandler.DownloadAttachment(nodeId, attachment.Hash).catch(e => {
+            setDownloading(false)
+            setError(String(e))
+        })
+    }
+    const save = () => {
+        window.backend.ViewHandler.GetAttachment(nodeId, attachment.Hash).then(data => {
+            downloadDocument(base64ToBytes(data), attachment.Name, attachment.MediaType)
+        }).catch(e => setError(String(e)))
+    }
+
+    return (
+        <li className="mb-1">
+            { thumbnail && <img className="d-block mb-1" src={thumbnail} alt={attachment.Name}/> }
+            {attachment.Name} <small className="text-muted">({formatSize(attachment.Size)})</small>
+            { complete && <button type="button" className="btn btn-link btn-sm" onClick={save}>save</button> }
+            { !complete && !downloading &&
+                <button type="button" className="btn btn-link btn-sm" onClick={download}>download</button> }
+            { downloading &&
+                <div className="progress w-25">
+                    <div className="progress-bar" role="progressbar" style={{width: (100 * stored / attachment.Chunks) + "%"}}
+                        aria-valuenow={stored} aria-valuemin="0" aria-valuemax={attachment.Chunks}/>
+                </div> }
+            { error && <small className="text-danger ms-2">{error}</small> }
+        </li>
+    );
+}
+
+export default Attachments;
@@ -7,15 +7,27 @@ const NewTopic = () => {
     const [loading, setLoading] = useState(false)
     const [topic, setTopic] = useState("")
     const [detail, setDetail] = useState("")
+    const [isPoll, setIsPoll] = useState(false)
+    const [options, setOptions] = useState("")
+
+    // Poll options are entered one per line
+    const pollOptions = options.split("\n").map(o => o.trim()).filter(o => o.length > 0)
 
     const createTopic = () => {
         setStatus("")
         setLoading(true)
-        window.backend.ViewHandler.CreateTopic(topic, detail).then( res => {
+        const created = isPoll
+            ? window.backend.ViewHandler.CreatePoll(topic, detail, "", pollOptions, 0)
+            : window.backend.ViewHandler.CreateTopic(topic, detail)
+        created.then( res => {
                 setLoading(false)
                 setTopic("")
                 setDetail("")
-                setStatus("Successfully created topic")
+                setOptions("")
+                setStatus(isPoll ? "Successfully created poll" : "Successfully created topic")
+            }).catch( e => {
+                setLoading(false)
+                setStatus(String(e))
             })
     }
 
@@ -44,10 +56,22 @@ const NewTopic = () => {
                     {getDetailValidationMessage()}
                 </div>
                 </div>
+
+                <div className="form-check mt-3 text-start">
+                    <input className="form-check-input" type="checkbox" id="poll-field" checked={isPoll} onChange={(e) => setIsPoll(e.target.checked)}/>
+                    <label className="form-check-label" htmlFor="poll-field">Ask to choose between options</label>
+                </div>
+                { isPoll &&
+                <div>
+                <label htmlFor="options-field" className="form-label mt-3">Options, one per line (2 to 16)</label>
+                <textarea className={"form-control " + (pollOptions.length >= 2 && pollOptions.length <= 16 ? "" : "is-invalid")}
+                    id="options-field" rows="4" value={options} onChange={(e) => setOptions(e.target.value)}/>
+                </div> }
                 
                 <div className="mt-3">
                     <button className="btn btn-primary" 
-                        disabled={loading || topic.length === 0 || detail.length === 0 || !validateTitle(topic) || !validateDetail(detail)} 
+                        disabled={loading || topic.length === 0 || detail.length === 0 || !validateTitle(topic) || !validateDetail(detail)
+                            || (isPoll && (pollOptions.length < 2 || pollOptions.length > 16))} 
                         onClick={createTopic}>Create Topic</button>
                 </div>
             </div>
@@ -0,0 +1,19 @@
+import React from 'react';
+
+// Content is sanitized HTML rendered from Markdown by the backend
+function NodeContent({ html, className = "" }) {
+    // External links open in the browser instead of replacing the application
+    const openExternal = (e) => {
+        const link = e.target.closest('a.external')
+        if (link) {
+            e.preventDefault()
+            window.wails.Browser.OpenURL(link.href)
+        }
+    }
+    return (
+        <div className={"node-content " + className} onClick={openExternal}
+            dangerouslySetInnerHTML={{ __html: html }}/>
+    );
+}
+
+export default NodeContent;
@@ -0,0 +1,21 @@
+import React from 'react';
+
+export const orders = {
+    random: "Random",
+    newest: "Newest",
+    oldest: "Oldest",
+    active: "Most active",
+    agreed: "Most agreed",
+    contested: "Most contested",
+}
+
+function OrderSelect({ order, changeOrder }) {
+    return (
+        <select className="form-select w-auto d-inline-block mb-3" aria-label="Sort order"
+            value={order} onChange={(e) => changeOrder(e.target.value)}>
+            { Object.keys(orders).map(k => <option key={k} value={k}>{orders[k]}</option>) }
+        </select>
+    );
+}
+
+export default OrderSelect;
@@ -0,0 +1,36 @@
+import React from 'react';
+import { formatTimestamp } from '../util/Util';
+import NodeContent from './NodeContent';
+
+// Replies received before their parent, shown with a placeholder until the parent arrives
+function Orphans({ orphans, parents }) {
+    if (orphans.length === 0) {
+        return null
+    }
+    return (
+        <div className="mt-4">
+            <h5>Replies Waiting for Their Discussion</h5>
+            { orphans.map(o => {
+                const parent = parents[o.Parent]
+                return (
+                    <div key={o.ID} className="card text-start bg-light mb-3">
+                        <div className="card-header">
+                            { parent
+                                ? <>Reply to <strong>{parent.Short}</strong>{parent.ContextLoading && ", earlier context still loading"}</>
+                                : <span className="text-muted">
+                                    <span className="spinner-border spinner-border-sm me-2" role="status"/>context still loading
+                                </span> }
+                            <small className="text-muted float-end">{formatTimestamp(o.Timestamp)}</small>
+                        </div>
+                        <div className="card-body">
+                            <strong>{o.Short}</strong>
+                            <NodeContent html={o.LongHTML}/>
+                        </div>
+                    </div>
+                );
+            }) }
+        </div>
+    );
+}
+
+export default Orphans;
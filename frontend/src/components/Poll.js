@@ -0,0 +1,51 @@
+import React, { useState, useEffect } from 'react';
+import { formatTimestamp } from '../util/Util';
+import { onPollUpdate } from '../util/Events';
+
+// Options of a poll with their votes, voting again replaces the previous vote
+function Poll({ pollId }) {
+    const [results, setResults] = useState(null)
+    const [error, setError] = useState("")
+
+    useEffect(() => {
+        window.backend.ViewHandler.GetPollResults(pollId).then(setResults).catch(e => setError(String(e)))
+        return onPollUpdate(pollId, setResults)
+    }, [pollId])
+
+    const vote = (option) => {
+        setError("")
+        window.backend.ViewHandler.Vote(pollId, option).then(() => {
+            return window.backend.ViewHandler.GetPollResults(pollId).then(setResults)
+        }).catch(e => setError(String(e)))
+    }
+
+    if (!results) {
+        return error ? <small className="text-danger">{error}</small> : null
+    }
+    return (
+        <div className="mb-3 text-start">
+            { results.Options.map((option, i) => {
+                const share = results.Votes > 0 ? Math.round(100 * results.Counts[i] / results.Votes) : 0
+                return (
+                    <div key={i} className="mb-2">
+                        <button type="button" disabled={results.Closed}
+                            className={"btn btn-sm me-2 " + (results.MyVote === i ? "btn-dark" : "btn-outline-dark")}
+                            onClick={() => vote(i)}>{option}</button>
+                        <small className="text-muted">{results.Counts[i]} votes</small>
+                        <div className="progress mt-1">
+                            <div className="progress-bar" role="progressbar" style={{width: share + "%"}}
+                                aria-valuenow={share} aria-valuemin="0" aria-valuemax="100"/>
+                        </div>
+                    </div>
+                )
+            }) }
+            <small className="text-muted">
+                {results.Votes} votes{results.Duplicates + results.Invalid > 0 && `, ${results.Duplicates + results.Invalid} not counted`}
+                {results.Closes > 0 && (results.Closed ? " - closed " : " - closes ") + formatTimestamp(results.Closes)}
+            </small>
+            { error && <small className="text-danger ms-2">{error}</small> }
+        </div>
+    );
+}
+
+export default Poll;
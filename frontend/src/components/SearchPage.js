@@ -1,7 +1,9 @@
 import React, {useState, useEffect } from "react";
 import { Link } from "react-router-dom";
+import OrderSelect from "./OrderSelect";
+import Orphans from "./Orphans";
 
-const SearchPage = ({ getTopics, register, topics }) => {
+const SearchPage = ({ getTopics, register, topics, order, changeOrder, orphans, orphanParents }) => {
     const [loaded, setLoaded] = useState(false)
 
     useEffect(() => {
@@ -15,10 +17,7 @@ const SearchPage = ({ getTopics, register, topics }) => {
             <h1>Find Topics</h1>
             <hr/>
             </div>
-            <div className="alert alert-primary alert-dismissible fade show" role="alert">
-                Note that topics are displayed in a random order
-                <button type="button" className="btn-close" data-bs-dismiss="alert" aria-label="Close"></button>
-            </div>
+            <OrderSelect order={order} changeOrder={o => changeOrder(o, getTopics)}/>
             { loaded && 
                 <div className="row row-cols-1 row-cols-md-2 row-cols-xl-3">
                     {topics.map( n => {
@@ -40,6 +39,7 @@ const SearchPage = ({ getTopics, register, topics }) => {
                 </div>
             }
             <button className="btn btn-primary" onClick={getTopics}>Refresh</button>
+            <Orphans orphans={orphans} parents={orphanParents}/>
         </div>
     );
 }
@@ -1,23 +1,37 @@
-import React, { useState } from 'react';
+import React, { useState, useEffect } from 'react';
 import { useParams } from "react-router-dom";
 import {getTitleValidationMessage, getDetailValidationMessage, 
     validateTitle, validateDetail} from "../util/Validation"; 
-import { indicatorToText } from '../util/Util';
+import { indicatorToText, formatTimestamp, downloadDocument, readFileAsBase64 } from '../util/Util';
+import OrderSelect from './OrderSelect';
+import NodeContent from './NodeContent';
+import Attachments from './Attachments';
+import Poll from './Poll';
 
-function Topic({ data, loadMore, newComment }) {
+function Topic({ data, loadMore, newComment, order, changeOrder, reload }) {
 
     let params = useParams();
 
+    // Receive the new nodes of the whole topic while it is displayed
+    useEffect(() => {
+        window.backend.ViewHandler.SubscribeSubtree(params.topicId)
+        return () => { window.backend.ViewHandler.UnsubscribeSubtree(params.topicId) }
+    }, [params.topicId])
+
 	return (
         <>
         { data && data[params.topicId] && 
         <><div className="text-center">
-            <div className="alert alert-primary alert-dismissible fade show" role="alert">
-                Note that comments are displayed in a random order
-                <button type="button" className="btn-close" data-bs-dismiss="alert" aria-label="Close"></button>
-            </div>
+            <OrderSelect order={order} changeOrder={o => changeOrder(o, () => reload(params.topicId))}/>
+            <ExportButtons topicId={params.topicId}/>
             <h1>{data[params.topicId].Short}</h1>
-            <p>{data[params.topicId].Long}</p>
+            <p className="text-muted">
+                {formatTimestamp(data[params.topicId].Timestamp)} - {data[params.topicId].Descendants} replies,
+                last activity {formatTimestamp(data[params.topicId].LastActivity)}
+            </p>
+            <NodeContent html={data[params.topicId].LongHTML}/>
+            <Attachments nodeId={params.topicId} attachments={data[params.topicId].Attachments}/>
+            { data[params.topicId].IsPoll && <Poll pollId={params.topicId}/> }
 		</div>
         <hr/>
         <NewComment parent={params.topicId} newComment={newComment}/>
@@ -38,15 +52,36 @@ function Topic({ data, loadMore, newComment }) {
 
 export default Topic;
 
+function ExportButtons({ topicId }) {
+    const exportThread = (format, filename, type) => {
+        window.backend.ViewHandler.ExportThread(topicId, format).then(document => {
+            downloadDocument(document, filename, type)
+        })
+    }
+    return (
+        <div className="btn-group ms-2 mb-3" role="group" aria-label="Export">
+            <button type="button" className="btn btn-outline-secondary"
+                onClick={() => exportThread("markdown", "thread.md", "text/markdown")}>Export Markdown</button>
+            <button type="button" className="btn btn-outline-secondary"
+                onClick={() => exportThread("html", "thread.html", "text/html")}>Export HTML</button>
+        </div>
+    );
+}
+
 function Comment({ data = {}, loadMore, newComment }) {
     const [childrenLoaded, setChildrenLoaded] = useState(false)
     return (
         <div className="card text-left text-dark bg-light mt-3">
             <div className="card-header">
                 {data.Short} - {indicatorToText(data.Indicator)}
+                <small className="text-muted float-end">
+                    {formatTimestamp(data.Timestamp)} - {data.Replies} replies ({data.Descendants} in thread)
+                </small>
             </div>
             <div className="card-body pb-2">
-                <p className="card-text">{data.Long}</p>
+                <NodeContent className="card-text" html={data.LongHTML}/>
+                <Attachments nodeId={data.ID} attachments={data.Attachments}/>
+                { data.IsPoll && <Poll pollId={data.ID}/> }
                 <hr/>
                 { !childrenLoaded && <button className="btn btn-outline-dark me-2 py-1" type="button" onClick={() => {
                     loadMore(data.ID); setChildrenLoaded(true);
@@ -70,12 +105,20 @@ function NewComment(props) {
     const [indicator, setIndicator] = useState(5)
     const [topic, setTopic] = useState("")
     const [detail, setDetail] = useState("")
+    const [files, setFiles] = useState([])
 
     const cleanUpAndClose = () => {
         setShowModal(false)
         setIndicator(5)
         setTopic("")
         setDetail("")
+        setFiles([])
+    }
+
+    const submit = () => {
+        Promise.all(files.map(f => readFileAsBase64(f).then(data => ({Name: f.name, MediaType: f.type, Data: data}))))
+            .then(uploads => props.newComment(topic, detail, indicator, props.parent, uploads))
+        cleanUpAndClose()
     }
 
     return (
@@ -112,6 +155,12 @@ function NewComment(props) {
                     {getDetailValidationMessage()}
                 </div>
                 </div>
+
+                <div>
+                <label htmlFor="attachments-field" className="form-label mt-3">Attachments</label>
+                <input type="file" multiple className="form-control" id="attachments-field"
+                    onChange={(e) => setFiles(Array.from(e.target.files).slice(0, 4))}/>
+                </div>
                 
                 <div className="mt-3">
                     <button className="btn btn-outline-danger" onClick={() => {
@@ -119,10 +168,7 @@ function NewComment(props) {
                     }}>Cancel</button>
                     <button className="btn btn-primary ms-2" 
                     disabled={topic.length === 0 || detail.length === 0 || !validateTitle(topic) || !validateDetail(detail)} 
-                    onClick={() => {
-                        props.newComment(topic, detail, indicator, props.parent)
-                        cleanUpAndClose()
-                    }}>Add Comment</button>
+                    onClick={submit}>Add Comment</button>
                 </div>
             </div>
         </form>
@@ -2,10 +2,16 @@ import _ from 'lodash';
 
 const pathMap = new Map()
 
+const nodeDetails = (node) => ({
+    Short: node.Short, Long: node.Long, LongHTML: node.LongHTML, Indicator: node.Indicator,
+    Timestamp: node.Timestamp, Replies: node.Replies, Descendants: node.Descendants,
+    LastActivity: node.LastActivity, Depth: node.Depth, Difficulty: node.Difficulty,
+    Attachments: node.Attachments, IsPoll: node.IsPoll,
+})
+
 export const addTopic = (topic, state) => {
     pathMap.set(topic.ID, "")
-    state[topic.ID] = { Short: topic.Short, Long: topic.Long, 
-        Indicator: topic.Indicator, Children: {} }
+    state[topic.ID] = { ...nodeDetails(topic), Children: {} }
 }
 
 export const addNodes = (nodes, state) => {
@@ -30,7 +36,7 @@ export const addNode = (node, state) => {
         lodashPath.push(node.ID)
         _.set(state, 
             lodashPath, 
-            {Short: node.Short, Long: node.Long, Indicator: node.Indicator, Children: {}}
+            {...nodeDetails(node), Children: {}}
         )
     }
 }
\ No newline at end of file
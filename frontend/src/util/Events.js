@@ -0,0 +1,24 @@
+// Dispatches events of the backend to the components displaying the item they concern,
+// a single wails listener being registered for each event
+const keyedEvent = (event, keyOf) => {
+    const listeners = new Map()
+    let registered = false
+    return (key, listener) => {
+        if (!registered) {
+            window.wails.Events.On(event, data => {
+                (listeners.get(keyOf(data)) || []).forEach(l => l(data))
+            })
+            registered = true
+        }
+        listeners.set(key, [...(listeners.get(key) || []), listener])
+        return () => {
+            listeners.set(key, (listeners.get(key) || []).filter(l => l !== listener))
+        }
+    }
+}
+
+export const onDownloadProgress = keyedEvent('attachment_progress', progress => progress.Hash)
+
+export const onPollUpdate = keyedEvent('poll_updated', results => results.PollID)
+
+export const onPostDone = keyedEvent('attachment_post_done', done => done.ID)
@@ -28,4 +28,41 @@ export const indicatorToText = (indicator) => {
         default:
             return "No Opinion"
     }
-}
\ No newline at end of file
+}
+
+export const formatTimestamp = (timestamp) => {
+    return new Date(timestamp * 1000).toLocaleString()
+}
+
+// Save a document generated by the backend as a file
+export const downloadDocument = (content, filename, type) => {
+    const link = document.createElement('a')
+    link.href = URL.createObjectURL(new Blob([content], { type: type }))
+    link.download = filename
+    link.click()
+    URL.revokeObjectURL(link.href)
+}
+
+export const formatSize = (size) => {
+    if (size < 1024) {
+        return size + " B"
+    }
+    if (size < 1024 * 1024) {
+        return (size / 1024).toFixed(1) + " KB"
+    }
+    return (size / 1024 / 1024).toFixed(1) + " MB"
+}
+
+// Read a file picked by the user as base64, the encoding files are sent to the backend with
+export const readFileAsBase64 = (file) => {
+    return new Promise((resolve, reject) => {
+        const reader = new FileReader()
+        reader.onload = () => resolve(reader.result.substring(reader.result.indexOf(',') + 1))
+        reader.onerror = () => reject(reader.error)
+        reader.readAsDataURL(file)
+    })
+}
+
+export const base64ToBytes = (data) => {
+    return Uint8Array.from(atob(data), c => c.charCodeAt(0))
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"dforum-app/api"
+	"dforum-app/cli"
 	"dforum-app/configuration"
+	"dforum-app/daemon"
 	"dforum-app/network"
 	"dforum-app/storage"
 	"dforum-app/view"
 	_ "embed"
+	"flag"
+	"fmt"
 	"os"
 
 	"github.com/wailsapp/wails"
@@ -21,13 +26,51 @@ var vHandle *view.ViewHandler
 var networkHandle *network.NetworkModule
 
 func main() {
+	exportKey := flag.String("export-network-key", "", "generate a private forum key, use it and export it to the given file")
+	importKey := flag.String("import-network-key", "", "join the private forum whose key is in the given file")
+	headless := flag.Bool("headless", false, "run without the GUI until SIGINT or SIGTERM is received")
+	pidFile := flag.String("pid-file", "dforum.pid", "file storing the process ID in headless mode")
+	statusFile := flag.String("status-file", "dforum-status.json", "file storing the node status in headless mode")
+	flag.Parse()
+
 	wd, _ := os.Getwd()
+	// Subcommands of the command line client
+	if flag.NArg() > 0 {
+		configuration.DisableLogging()
+		configuration.InitConfigs(wd)
+		os.Exit(cli.Run(flag.Args(), os.Stdout, os.Stderr))
+	}
 	configuration.InitConfigs(wd)
 	logPath := wd + string(os.PathSeparator) + "dfd.log"
 	logFile, _ := os.Create(logPath)
 	logFile.Close() // Create a new empty file or truncate existing
 	configuration.InitLogger(logPath)
 
+	if *exportKey != "" {
+		if err := network.ExportNewNetworkKey(*exportKey); err != nil {
+			fmt.Fprintln(os.Stderr, "could not export network key:", err)
+			os.Exit(1)
+		}
+		fmt.Println("private forum key exported to", *exportKey)
+		return
+	}
+	if *importKey != "" {
+		if err := network.ImportNetworkKey(*importKey); err != nil {
+			fmt.Fprintln(os.Stderr, "could not import network key:", err)
+			os.Exit(1)
+		}
+		fmt.Println("private forum key imported from", *importKey)
+		return
+	}
+
+	if *headless {
+		if err := daemon.Run(*pidFile, *statusFile); err != nil {
+			fmt.Fprintln(os.Stderr, "could not start headless mode:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	storageModule := storage.NewStorageModule(configuration.GetDatabasePath())
 	defer storageModule.TearDown()
 
@@ -37,6 +80,15 @@ func main() {
 	networkHandle.CreateAndStartHost()
 	defer networkHandle.TearDown()
 
+	if control, err := cli.ServeControl(configuration.GetControlSocket(), cli.NewLocalBackend(storageModule, networkHandle)); err != nil {
+		configuration.Logger.Error("could not open control socket:", err.Error())
+	} else {
+		defer control.Close()
+	}
+	if apiServer := api.StartFromConfig(storageModule, networkHandle); apiServer != nil {
+		defer apiServer.Close()
+	}
+
 	app := wails.CreateApp(&wails.AppConfig{
 		Width:     1024,
 		Height:    768,
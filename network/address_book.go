@@ -0,0 +1,243 @@
+package network
+
+import (
+	"dforum-app/configuration"
+	"dforum-app/network/communication"
+	"dforum-app/storage"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const (
+	reconnectBaseBackoff = 30 * time.Second
+	reconnectMaxBackoff  = 24 * time.Hour
+	// Peers not seen for this long are forgotten
+	peerRecordExpiry = 30 * 24 * time.Hour
+	// The least recently seen peers are forgotten beyond this many records
+	maxPeerRecords = 1000
+)
+
+// The address book remembers the forum peers connected to, with all their addresses,
+// when they were last seen and how often connecting to them succeeded.
+// Peers not speaking the message protocol, such as DHT servers, are not recorded.
+// It is persisted in storage and used to pick peers to reconnect to on startup.
+type AddressBook struct {
+	sync.Mutex
+	records      map[peer.ID]*storage.PeerRecord
+	host         host.Host
+	sub          event.Subscription
+	localStorage *storage.StorageModule
+}
+
+func NewAddressBook(sm *storage.StorageModule) *AddressBook {
+	ab := &AddressBook{
+		records:      make(map[peer.ID]*storage.PeerRecord),
+		localStorage: sm,
+	}
+	for v, record := range sm.GetPeerRecords() {
+		p, err := peer.Decode(v)
+		if err != nil || isExpiredRecord(&record, time.Now()) {
+			sm.DeletePeerRecord(v)
+			continue
+		}
+		r := record
+		ab.records[p] = &r
+	}
+	return ab
+}
+
+// Start recording the peers the host connects to, once they identified their protocols
+func (ab *AddressBook) Start(h host.Host) {
+	ab.Lock()
+	ab.host = h
+	ab.Unlock()
+	sub, err := h.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	if err != nil {
+		configuration.Logger.Error("could not subscribe to peer identification:", err.Error())
+		return
+	}
+	ab.sub = sub
+	go func() {
+		for e := range sub.Out() {
+			ab.Seen(e.(event.EvtPeerIdentificationCompleted).Peer)
+		}
+	}()
+}
+
+// Record the connected peers a last time before shutting down
+func (ab *AddressBook) Stop() {
+	ab.Lock()
+	h := ab.host
+	ab.Unlock()
+	if h == nil {
+		return
+	}
+	if ab.sub != nil {
+		ab.sub.Close()
+	}
+	for _, p := range h.Network().Peers() {
+		ab.Seen(p)
+	}
+}
+
+// Update the addresses and protocols of a peer the host is or was connected to,
+// peers not speaking the message protocol are ignored
+func (ab *AddressBook) Seen(p peer.ID) {
+	ab.Lock()
+	defer ab.Unlock()
+	if ab.host == nil || p == ab.host.ID() || !communication.SupportsMessageProtocol(ab.host, p) {
+		return
+	}
+	ab.seen(p)
+	ab.prune()
+}
+
+func (ab *AddressBook) seen(p peer.ID) *storage.PeerRecord {
+	r, ok := ab.records[p]
+	if !ok {
+		r = &storage.PeerRecord{}
+		ab.records[p] = r
+	}
+	r.LastSeen = time.Now()
+	if addrs := ab.host.Peerstore().Addrs(p); len(addrs) > 0 {
+		r.Addrs = []string{}
+		for _, addr := range addrs {
+			r.Addrs = append(r.Addrs, addr.String())
+		}
+	}
+	if protocols, err := ab.host.Peerstore().GetProtocols(p); err == nil && len(protocols) > 0 {
+		r.Protocols = protocols
+	}
+	ab.localStorage.StorePeerRecord(p.String(), *r)
+	return r
+}
+
+// Record the outcome of a connection attempt to a peer.
+// Peers are only added by successful attempts, once they are known to speak the message protocol.
+func (ab *AddressBook) RecordDial(p peer.ID, success bool) {
+	ab.Lock()
+	defer ab.Unlock()
+	r, ok := ab.records[p]
+	if !ok {
+		if !success || ab.host == nil || !communication.SupportsMessageProtocol(ab.host, p) {
+			return
+		}
+		r = ab.seen(p)
+	}
+	r.LastAttempt = time.Now()
+	if success {
+		r.Successes++
+		r.ConsecutiveFailures = 0
+	} else {
+		r.Failures++
+		r.ConsecutiveFailures++
+	}
+	ab.localStorage.StorePeerRecord(p.String(), *r)
+}
+
+// Peers to reconnect to, excluding the ones still backing off after failed attempts.
+// Reliable and recently seen peers come first.
+func (ab *AddressBook) Candidates(max int) []peer.AddrInfo {
+	ab.Lock()
+	defer ab.Unlock()
+	now := time.Now()
+	type candidate struct {
+		info   peer.AddrInfo
+		record *storage.PeerRecord
+	}
+	candidates := []candidate{}
+	for p, r := range ab.records {
+		if now.Before(r.LastAttempt.Add(reconnectBackoff(r.ConsecutiveFailures))) || !speaksMessageProtocol(r) {
+			continue
+		}
+		info := peer.AddrInfo{ID: p}
+		for _, v := range r.Addrs {
+			if addr, err := multiaddr.NewMultiaddr(v); err == nil {
+				info.Addrs = append(info.Addrs, addr)
+			}
+		}
+		if len(info.Addrs) == 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{info, r})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i].record, candidates[j].record
+		if a.ConsecutiveFailures != b.ConsecutiveFailures {
+			return a.ConsecutiveFailures < b.ConsecutiveFailures
+		}
+		return a.LastSeen.After(b.LastSeen)
+	})
+	infos := []peer.AddrInfo{}
+	for i := 0; i < len(candidates) && i < max; i++ {
+		infos = append(infos, candidates[i].info)
+	}
+	return infos
+}
+
+// Snapshot of the address book for diagnostics
+func (ab *AddressBook) GetRecords() map[string]storage.PeerRecord {
+	ab.Lock()
+	defer ab.Unlock()
+	records := make(map[string]storage.PeerRecord)
+	for p, r := range ab.records {
+		records[p.String()] = *r
+	}
+	return records
+}
+
+// Forget the peers not seen for too long, then the least recently seen ones beyond maxPeerRecords
+func (ab *AddressBook) prune() {
+	now := time.Now()
+	for p, r := range ab.records {
+		if isExpiredRecord(r, now) {
+			configuration.Logger.Info("forgetting peer not seen for a long time:", p.ShortString())
+			delete(ab.records, p)
+			ab.localStorage.DeletePeerRecord(p.String())
+		}
+	}
+	for len(ab.records) > maxPeerRecords {
+		var oldest peer.ID
+		for p, r := range ab.records {
+			if oldest == "" || r.LastSeen.Before(ab.records[oldest].LastSeen) {
+				oldest = p
+			}
+		}
+		delete(ab.records, oldest)
+		ab.localStorage.DeletePeerRecord(oldest.String())
+	}
+}
+
+func reconnectBackoff(failures int) time.Duration {
+	if failures == 0 {
+		return 0
+	}
+	backoff := reconnectBaseBackoff
+	for i := 1; i < failures; i++ {
+		backoff *= 2
+		if backoff >= reconnectMaxBackoff {
+			return reconnectMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// Peers not seen for a long time are not worth retrying, whatever the outcome of the last attempts
+func isExpiredRecord(r *storage.PeerRecord, now time.Time) bool {
+	return now.Sub(r.LastSeen) > peerRecordExpiry
+}
+
+func speaksMessageProtocol(r *storage.PeerRecord) bool {
+	for _, p := range r.Protocols {
+		if p == string(communication.MessageProtocol) {
+			return true
+		}
+	}
+	return false
+}
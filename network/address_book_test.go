@@ -0,0 +1,95 @@
+package network
+
+import (
+	"context"
+	"dforum-app/network/communication"
+	"dforum-app/storage"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-tcp-transport"
+)
+
+func TestAddressBookPersistence(t *testing.T) {
+	path := "../test/addressbook/"
+	os.RemoveAll(path)
+	sM := storage.NewStorageModule(path)
+	defer sM.TearDown()
+	ab := NewAddressBook(sM)
+
+	h1 := newAddressBookHost(t)
+	h2 := newAddressBookHost(t)
+	h2.SetStreamHandler(communication.MessageProtocol, func(s network.Stream) { s.Close() })
+	// Peers not speaking the message protocol, such as DHT servers, are not recorded
+	dhtOnly := newAddressBookHost(t)
+	ab.Start(h1)
+	for _, h := range []host.Host{h2, dhtOnly} {
+		if err := h1.Connect(context.Background(), peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}); err != nil {
+			t.Fatal(err)
+		}
+		ab.RecordDial(h.ID(), true)
+	}
+	ab.Stop()
+
+	// Records are restored from storage
+	records := NewAddressBook(sM).GetRecords()
+	record, ok := records[h2.ID().String()]
+	if !ok {
+		t.Fatal("peer missing from the address book")
+	}
+	if len(record.Addrs) != len(h2.Addrs()) || record.Successes != 1 || record.LastSeen.IsZero() {
+		t.Fatal("unexpected peer record:", record)
+	}
+	if _, ok := records[dhtOnly.ID().String()]; ok {
+		t.Fatal("peers without the message protocol should not be recorded")
+	}
+	candidates := NewAddressBook(sM).Candidates(10)
+	if len(candidates) != 1 || candidates[0].ID != h2.ID() {
+		t.Fatal("peer should be a reconnect candidate")
+	}
+}
+
+func TestAddressBookBackoff(t *testing.T) {
+	path := "../test/addressbook-backoff/"
+	os.RemoveAll(path)
+	sM := storage.NewStorageModule(path)
+	defer sM.TearDown()
+	ab := NewAddressBook(sM)
+
+	h := newAddressBookHost(t)
+	ab.Start(h)
+	other := newAddressBookHost(t)
+	h.Peerstore().AddAddrs(other.ID(), other.Addrs(), time.Hour)
+	h.Peerstore().AddProtocols(other.ID(), string(communication.MessageProtocol))
+	ab.Seen(other.ID())
+	ab.RecordDial(other.ID(), false)
+	if len(ab.Candidates(10)) != 0 {
+		t.Fatal("peer should not be retried before its backoff ends")
+	}
+	if reconnectBackoff(1) != reconnectBaseBackoff || reconnectBackoff(100) != reconnectMaxBackoff {
+		t.Fatal("unexpected reconnect backoff")
+	}
+
+	// Peers not seen for too long are forgotten, even if the last attempts succeeded
+	sM.StorePeerRecord(other.ID().String(), storage.PeerRecord{LastSeen: time.Now().Add(-peerRecordExpiry - time.Hour), Successes: 3})
+	if _, ok := NewAddressBook(sM).GetRecords()[other.ID().String()]; ok {
+		t.Fatal("expired peer record should be forgotten")
+	}
+}
+
+func newAddressBookHost(t *testing.T) host.Host {
+	h, err := libp2p.New(
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.Transport(tcp.NewTCPTransport),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/libp2p/go-libp2p-core/connmgr"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -15,34 +16,38 @@ import (
 )
 
 type CommunicationManager struct {
-	ctx              context.Context
-	host             host.Host
-	localStorage     *storage.StorageModule
-	inventoryHandler InventoryHandler
+	ctx          context.Context
+	host         host.Host
+	localStorage *storage.StorageModule
+	wantList     *WantList
+	wantSignal   chan struct{}
+	stopWants    context.CancelFunc
+	peerScores   *PeerScoreTracker
+	rateLimiter  *RateLimiter
+	// Set when nodes are propagated with gossipsub rather than inventory messages
+	gossip *GossipPropagator
 }
 
 func NewCommunicationManager(sm *storage.StorageModule) *CommunicationManager {
 	cM := &CommunicationManager{
-		localStorage:     sm,
-		inventoryHandler: NewInventoryHandler(),
+		localStorage: sm,
+		wantList:     NewWantList(sm),
+		wantSignal:   make(chan struct{}, 1),
+		peerScores:   NewPeerScoreTracker(sm),
+		rateLimiter:  NewRateLimiter(),
 	}
 	sm.Subscribe(cM)
+	sm.SetAttachmentFetcher(cM)
 	return cM
 }
 
 func (cm *CommunicationManager) TearDown() {
-	// Store addresses of current peers before shutting down
-	currentPeerAddresses := []string{}
-	for _, peerID := range cm.host.Network().Peers() {
-		peerInfo := peer.AddrInfo{
-			ID:    peerID,
-			Addrs: cm.host.Network().Peerstore().Addrs(peerID),
-		}
-		addrs, _ := peer.AddrInfoToP2pAddrs(&peerInfo)
-		currentPeerAddresses = append(currentPeerAddresses,
-			addrs[0].String())
+	if cm.stopWants != nil {
+		cm.stopWants()
+	}
+	if cm.gossip != nil {
+		cm.gossip.Close()
 	}
-	configuration.SetNetworkPeers(currentPeerAddresses)
 	cm.host.Close()
 }
 
@@ -60,20 +65,62 @@ func (cm *CommunicationManager) GetProtocolID() protocol.ID {
 func (cm *CommunicationManager) SetHost(h host.Host, ctx context.Context) {
 	cm.host = h
 	cm.ctx = ctx
+	cm.peerScores.SetHost(h)
+	// Start fetching wanted nodes once peers can be reached
+	wantCtx, cancel := context.WithCancel(ctx)
+	cm.stopWants = cancel
+	go cm.processWants(wantCtx)
 }
 
 func (cm *CommunicationManager) GetHost() (h host.Host, ctx context.Context) {
 	return cm.host, cm.ctx
 }
 
-func (cm *CommunicationManager) Sync(p peer.ID) {
-	cm.SendSyncRequest(p)
+func (cm *CommunicationManager) Sync(p peer.ID) bool {
+	return cm.SendSyncRequest(p)
+}
+
+// Connection gater refusing banned peers, to be used when creating the host
+func (cm *CommunicationManager) GetConnectionGater() connmgr.ConnectionGater {
+	return cm.peerScores
+}
+
+// Inspect the reputation of peers
+func (cm *CommunicationManager) GetPeerScores() []PeerScoreInfo {
+	return cm.peerScores.GetScores()
+}
+
+// Propagate new nodes using gossipsub channels instead of direct inventory messages.
+// Must be called after the host is set.
+func (cm *CommunicationManager) EnableGossipSub() error {
+	g, err := NewGossipPropagator(cm.ctx, cm.host, cm.localStorage, cm.peerScores, cm.storeGossipNode)
+	if err != nil {
+		return err
+	}
+	cm.gossip = g
+	return nil
 }
 
 func (cm *CommunicationManager) RegisterNewNode(n *storage.Node) {
+	// Gossip routers forward the nodes they receive themselves
+	if cm.gossip != nil {
+		return
+	}
 	cm.SendInventoryMessage(n.GetFingerprint())
 }
 
+// Only nodes created on this peer are published on gossip channels
+func (cm *CommunicationManager) RegisterLocalNode(n *storage.Node) {
+	if cm.gossip != nil {
+		cm.gossip.Publish(n)
+	}
+}
+
+// Inspect nodes announced by peers that are still waiting to be fetched
+func (cm *CommunicationManager) GetWantList() []WantInfo {
+	return cm.wantList.GetWants()
+}
+
 /*
 	Communication Actions
 */
@@ -83,6 +130,7 @@ func (cm *CommunicationManager) handleInventoryMessage(msg []byte, s network.Str
 	id, err := getHashSignatureFromMessage(msg)
 	if err != nil {
 		configuration.Logger.Error(s.ID(), "received invalid inventory message")
+		cm.peerScores.Record(s.Conn().RemotePeer(), InvalidFrame)
 		return
 	}
 	configuration.Logger.Info(s.ID(), "receieved inventory message:", id[0:4])
@@ -103,6 +151,7 @@ func (cm *CommunicationManager) handleDataRequest(msg []byte, s network.Stream)
 	id, err := getHashSignatureFromMessage(msg)
 	if err != nil {
 		configuration.Logger.Error(s.ID(), "received invalid data request")
+		cm.peerScores.Record(s.Conn().RemotePeer(), InvalidFrame)
 		sendInvalidMessage(s)
 		return
 	}
@@ -119,45 +168,135 @@ func (cm *CommunicationManager) handleDataRequest(msg []byte, s network.Stream)
 	}
 }
 
+// Request a node from a peer, a single attempt is made.
+// Retries across peers are scheduled by the want list.
 func (cm *CommunicationManager) SendDataRequest(id security.HashSignature, peer peer.ID) bool {
-	for i := 0; i < 5; i++ { // try 5 times
-		s, err := getPeerStream(peer, cm.host, cm.ctx)
-		if err != nil {
-			configuration.Logger.Error("failed to get stream for data request from peer:", peer.ShortString(), err.Error())
-			continue
-		}
-		configuration.Logger.Info(s.ID(), "sending data request:", id[0:4])
-		msg := BuildDataRequestMsg(id)
-		response, err := sendRequestWithResponse(msg, s)
-		if err != nil {
-			configuration.Logger.Errorf("%s failed to complete data request %d/5: %s", s.ID(), i, err.Error())
-			continue
-		}
-		node := storage.ParseNode(response)
-		if node == nil { // Failed to receive a valid node
-			configuration.Logger.Error(s.ID(), "invalid node received")
-			continue
-		}
-		if ok := node.Verify(); ok {
-			cm.localStorage.StoreNode(node)
-			cm.localStorage.PublishNode(node)
+	if cm.rateLimiter.IsBackingOff(peer) {
+		return false
+	}
+	s, err := getPeerStream(peer, cm.host, cm.ctx)
+	if err != nil {
+		configuration.Logger.Error("failed to get stream for data request from peer:", peer.ShortString(), err.Error())
+		return false
+	}
+	configuration.Logger.Info(s.ID(), "sending data request:", id[0:4])
+	msg := BuildDataRequestMsg(id)
+	response, err := sendRequestWithResponse(msg, s, maxNodeResponseSize)
+	if err != nil {
+		configuration.Logger.Error(s.ID(), "failed to complete data request:", err.Error())
+		cm.peerScores.Record(peer, readFailureEvent(err))
+		return false
+	}
+	if isThrottledMessage(response) {
+		cm.rateLimiter.BackOff(peer)
+		return false
+	}
+	if isInvalidMessage(response) { // Peer does not have the node
+		configuration.Logger.Info(s.ID(), "peer could not serve data request")
+		return false
+	}
+	node := storage.ParseNode(response)
+	if node == nil { // Failed to receive a valid node
+		configuration.Logger.Error(s.ID(), "invalid node received")
+		cm.peerScores.Record(peer, InvalidFrame)
+		return false
+	}
+	if node.GetFingerprint() != id {
+		configuration.Logger.Error(s.ID(), "node received does not match the requested hash")
+		cm.peerScores.Record(peer, FailedVerification)
+		return false
+	}
+	if ok := node.Verify(); !ok {
+		configuration.Logger.Error(s.ID(), "node received did not meet security verifications")
+		cm.peerScores.Record(peer, FailedVerification)
+		return false
+	}
+	cm.peerScores.Record(peer, UsefulNode)
+	cm.localStorage.StoreNode(node)
+	cm.localStorage.PublishNode(node)
+	return true
+}
+
+func (cm *CommunicationManager) handleChunkRequest(msg []byte, s network.Stream) {
+	// Parse
+	hash, index, err := getChunkFromMessage(msg)
+	if err != nil {
+		configuration.Logger.Error(s.ID(), "received invalid chunk request")
+		cm.peerScores.Record(s.Conn().RemotePeer(), InvalidFrame)
+		sendInvalidMessage(s)
+		return
+	}
+	configuration.Logger.Info(s.ID(), "received chunk request:", hash[0:4], index)
+	// Respond
+	chunk, ok := cm.localStorage.GetChunk(hash, index)
+	if !ok {
+		sendInvalidMessage(s)
+		return
+	}
+	err = simpleSend(chunk, s)
+	if err != nil {
+		configuration.Logger.Error(s.ID(), "failed to respond to chunk request:", err.Error())
+	}
+}
+
+// Fetch a chunk of an attachment from the first connected peer able to serve it
+func (cm *CommunicationManager) FetchChunk(a storage.Attachment, index int) bool {
+	if cm.host == nil {
+		return false
+	}
+	for _, p := range cm.host.Network().Peers() {
+		if cm.SendChunkRequest(a, index, p) {
 			return true
-		} else {
-			configuration.Logger.Error(s.ID(), "node received did not meet security verifications")
 		}
+	}
+	return false
+}
+
+// Request a chunk of an attachment from a peer, storing it if it matches the attachment
+func (cm *CommunicationManager) SendChunkRequest(a storage.Attachment, index int, peer peer.ID) bool {
+	if cm.rateLimiter.IsBackingOff(peer) {
+		return false
+	}
+	s, err := getPeerStream(peer, cm.host, cm.ctx)
+	if err != nil {
+		configuration.Logger.Error("failed to get stream for chunk request from peer:", peer.ShortString(), err.Error())
 		return false
 	}
+	configuration.Logger.Info(s.ID(), "sending chunk request:", a.Hash[0:4], index)
+	msg := BuildChunkRequestMsg(a.Hash, index)
+	response, err := sendRequestWithResponse(msg, s, maxChunkResponseSize)
+	if err != nil {
+		configuration.Logger.Error(s.ID(), "failed to complete chunk request:", err.Error())
+		cm.peerScores.Record(peer, readFailureEvent(err))
+		return false
+	}
+	// Chunks are checked first, a chunk of a single byte could be mistaken for a status message
+	if err := cm.localStorage.StoreChunk(a, index, response); err == nil {
+		cm.peerScores.Record(peer, UsefulNode)
+		return true
+	}
+	if isThrottledMessage(response) {
+		cm.rateLimiter.BackOff(peer)
+		return false
+	}
+	if isInvalidMessage(response) { // Peer does not have the chunk
+		configuration.Logger.Info(s.ID(), "peer could not serve chunk request")
+		return false
+	}
+	configuration.Logger.Error(s.ID(), "chunk received does not match the attachment")
+	cm.peerScores.Record(peer, FailedVerification)
 	return false
 }
 
 func (cm *CommunicationManager) handleSyncRequest(msg []byte, s network.Stream) {
 	// Decipher request
 	var unixTime int64
-	json.Unmarshal(msg, &unixTime)
+	err := json.Unmarshal(msg, &unixTime)
 	rTime := time.Unix(unixTime, 0)
 	// Time provided has to be in the past
-	if time.Now().Before(rTime) {
+	if err != nil || time.Now().Before(rTime) {
 		configuration.Logger.Error(s.ID(), "received invalid sync request")
+		cm.peerScores.Record(s.Conn().RemotePeer(), InvalidFrame)
 		sendInvalidMessage(s)
 		return
 	}
@@ -170,31 +309,50 @@ func (cm *CommunicationManager) handleSyncRequest(msg []byte, s network.Stream)
 	// Send Inv Messages
 	dataItems := cm.localStorage.GetNodesSince(rTime)
 	jsonItems, _ := json.Marshal(dataItems)
-	err := simpleSend(jsonItems, s)
+	err = simpleSend(jsonItems, s)
 	if err != nil {
 		configuration.Logger.Error(s.ID(), "failed to respond to sync request:", err.Error())
 	}
 }
 
-func (cm *CommunicationManager) SendSyncRequest(peer peer.ID) {
+// Request inventory of recent nodes from a peer.
+// Returns false if the peer could not be reached or did not respond.
+func (cm *CommunicationManager) SendSyncRequest(peer peer.ID) bool {
+	if cm.rateLimiter.IsBackingOff(peer) {
+		return false
+	}
 	t := cm.localStorage.TimeOfMostRecentNode()
 	msg := BuildSyncRequest(t)
 	s, err := getPeerStream(peer, cm.host, cm.ctx)
 	if err != nil {
 		configuration.Logger.Error("failed to get stream for sync request from peer:", peer.ShortString(), err.Error())
-		return
+		return false
 	}
 	configuration.Logger.Info(s.ID(), "sending sync request for date:", t.Format(time.RFC822Z))
-	data, err := sendRequestWithResponse(msg, s)
+	data, err := sendRequestWithResponse(msg, s, maxSyncResponseSize)
 	if err != nil {
 		configuration.Logger.Error(s.ID(), "failed to complete sync request:", err.Error())
-		return
+		cm.peerScores.Record(peer, readFailureEvent(err))
+		return false
+	}
+	if isThrottledMessage(data) {
+		cm.rateLimiter.BackOff(peer)
+		return false
+	}
+	if isInvalidMessage(data) {
+		configuration.Logger.Info(s.ID(), "peer could not serve sync request")
+		return false
 	}
 	var dataItems []security.HashSignature
-	json.Unmarshal(data, &dataItems)
+	if err := json.Unmarshal(data, &dataItems); err != nil {
+		configuration.Logger.Error(s.ID(), "received invalid sync response")
+		cm.peerScores.Record(peer, InvalidFrame)
+		return false
+	}
 	for _, v := range dataItems {
 		cm.registerNodeInv(v, peer)
 	}
+	return true
 }
 
 /*
@@ -205,13 +363,68 @@ func (cm *CommunicationManager) registerNodeInv(id security.HashSignature, peer
 	if cm.localStorage.NodeExists(id) {
 		return // Ignore inv if node already exists
 	}
-	lock := cm.inventoryHandler.GetLock(id)
-	lock.CompleteActionUntilSuccessful(func() bool {
-		if cm.SendDataRequest(id, peer) {
-			// Node stored successfully
-			cm.inventoryHandler.DeleteLock(id)
-			return true
+	if cm.wantList.Add(id, peer) {
+		cm.signalWants()
+	}
+}
+
+// Wake up the want processor without blocking
+func (cm *CommunicationManager) signalWants() {
+	select {
+	case cm.wantSignal <- struct{}{}:
+	default:
+	}
+}
+
+// Fetch due wants until the context is cancelled
+func (cm *CommunicationManager) processWants(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-cm.wantSignal:
 		}
-		return false
-	})
+		for _, task := range cm.wantList.nextDue(time.Now(), wantMaxInFlight) {
+			go cm.fetchWant(task)
+		}
+	}
+}
+
+// Store a node received on a gossip channel, it was verified by the channel validator
+func (cm *CommunicationManager) storeGossipNode(n *storage.Node, from peer.ID) {
+	id := n.GetFingerprint()
+	configuration.Logger.Info("received node from gossip peer:", id[0:4])
+	cm.wantList.Remove(id)
+	cm.localStorage.StoreNode(n)
+	cm.localStorage.PublishNode(n)
+	cm.requestMissingParent(id, from, 1)
+}
+
+func (cm *CommunicationManager) fetchWant(task wantTask) {
+	if cm.localStorage.NodeExists(task.id) || cm.SendDataRequest(task.id, task.peer) {
+		cm.wantList.Remove(task.id)
+		cm.requestMissingParent(task.id, task.peer, task.depth+1)
+		return
+	}
+	cm.wantList.Failed(task.id)
+}
+
+// Ask the peer that supplied a node for its parent if it is unknown locally.
+// Ancestors are requested recursively as they arrive, up to a depth limit.
+func (cm *CommunicationManager) requestMissingParent(id security.HashSignature, peer peer.ID, depth int) {
+	parent, missing := cm.localStorage.GetMissingParent(id)
+	if !missing {
+		return
+	}
+	if depth > maxAncestorDepth {
+		configuration.Logger.Errorf("not fetching parent %s of %s, ancestor depth limit reached", parent[0:4], id[0:4])
+		return
+	}
+	configuration.Logger.Info("requesting missing parent:", parent[0:4])
+	if cm.wantList.AddAncestor(parent, peer, depth) {
+		cm.signalWants()
+	}
 }
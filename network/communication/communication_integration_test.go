@@ -1,8 +1,10 @@
 package communication_test
 
 import (
+	"bytes"
 	"dforum-app/storage"
 	"fmt"
+	"os"
 	"testing"
 	"time"
 )
@@ -37,3 +39,28 @@ func TestSendSyncRequest(*testing.T) {
 	cM1.SendSyncRequest(h1.Network().Peers()[0])
 	time.Sleep(time.Second)
 }
+
+func TestChunkRequest(t *testing.T) {
+	os.RemoveAll("../../test/chunks/")
+	cM1, _, sM1 := createAndInitCommMgr(7068, "../../test/chunks/test1/")
+	cM2, addr2, sM2 := createAndInitCommMgr(8069, "../../test/chunks/test2/")
+	connectNodes(cM1, addr2)
+	defer cM1.TearDown()
+	defer cM2.TearDown()
+
+	content := bytes.Repeat([]byte{7}, storage.AttachmentChunkSize+1)
+	a, err := storage.NewAttachment("file.bin", "application/octet-stream", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sM2.StoreAttachment(a, content); err != nil {
+		t.Fatal(err)
+	}
+	progress := []int{}
+	if err := sM1.FetchAttachment(a, func(stored int, total int) { progress = append(progress, stored) }); err != nil {
+		t.Fatal("failed to fetch the attachment:", err)
+	}
+	if fetched, err := sM1.GetAttachmentContent(a); err != nil || !bytes.Equal(fetched, content) || len(progress) != 3 {
+		t.Fatal("unexpected attachment fetched:", progress, err)
+	}
+}
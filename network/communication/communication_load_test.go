@@ -4,12 +4,14 @@ import (
 	"bufio"
 	"context"
 	"crypto/rand"
+	"dforum-app/configuration"
 	"dforum-app/network/communication"
 	"io/ioutil"
 	"testing"
 	"time"
 
 	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/spf13/viper"
 )
 
 func TestHangingStreamReceiver(t *testing.T) {
@@ -104,3 +106,72 @@ func TestStreamBufferOverload(t *testing.T) {
 
 	cM2.SendSyncRequest(h2.Network().Peers()[0])
 }
+
+func TestSyncRequestFlood(t *testing.T) {
+	// Flood a peer with sync requests, requests beyond the burst have to be throttled
+	if testing.Short() {
+		t.Skip()
+	}
+	cM1, _, _ := createAndInitCommMgr(7068, "../../test/test1/")
+	cM2, addr2, _ := createAndInitCommMgr(8069, "../../test/test2/")
+	connectNodes(cM1, addr2)
+	defer cM1.TearDown()
+	defer cM2.TearDown()
+
+	h1, ctx := cM1.GetHost()
+	_, burst := configuration.GetSyncRequestLimit()
+	throttled := 0
+	for i := 0; i < burst+10; i++ {
+		s, err := h1.NewStream(ctx, h1.Network().Peers()[0], communication.MessageProtocol)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		s.Write(communication.BuildSyncRequest(time.Now().Add(-time.Hour)))
+		response, _ := ioutil.ReadAll(s)
+		s.Close()
+		if len(response) == 1 && response[0] == byte(communication.Throttled) {
+			throttled++
+		}
+	}
+	if throttled != 10 {
+		t.Fatalf("expected 10 throttled sync requests, got %d", throttled)
+	}
+	// The client gets throttled as well and backs off
+	if cM1.SendSyncRequest(h1.Network().Peers()[0]) {
+		t.Fatal("sync request should have been throttled")
+	}
+}
+
+func TestConcurrentHandlersCap(t *testing.T) {
+	// Hanging streams must not take more than the allowed number of handlers
+	if testing.Short() {
+		t.Skip()
+	}
+	viper.Set("network.limits.max-handlers", 4)
+	defer viper.Set("network.limits.max-handlers", nil)
+	cM1, _, _ := createAndInitCommMgr(7068, "../../test/test1/")
+	cM2, addr2, _ := createAndInitCommMgr(8069, "../../test/test2/")
+	connectNodes(cM1, addr2)
+	defer cM1.TearDown()
+	defer cM2.TearDown()
+
+	h1, ctx := cM1.GetHost()
+	for i := 0; i < 4; i++ {
+		s, err := h1.NewStream(ctx, h1.Network().Peers()[0], communication.MessageProtocol)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer s.Close()
+		s.Write([]byte{byte(communication.DataRequest)}) // Incomplete header keeps the handler busy
+	}
+	time.Sleep(200 * time.Millisecond)
+	s, err := h1.NewStream(ctx, h1.Network().Peers()[0], communication.MessageProtocol)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Write(communication.BuildDataRequestMsg([28]byte{}))
+	response, _ := ioutil.ReadAll(s)
+	if len(response) != 1 || response[0] != byte(communication.Throttled) {
+		t.Fatal("request exceeding the handlers cap was not throttled")
+	}
+}
@@ -0,0 +1,214 @@
+package communication
+
+import (
+	"context"
+	"dforum-app/configuration"
+	"dforum-app/security"
+	"dforum-app/storage"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+const (
+	gossipTopicPrefix = "/dforum/0.0.1/"
+	// Channel carrying new top level nodes, replies use the channel of their top level node
+	rootGossipTopic      = gossipTopicPrefix + "topics"
+	maxGossipMessageSize = 1 << 16
+)
+
+// Called with nodes received from the network once they passed validation
+type gossipNodeHandler func(n *storage.Node, from peer.ID)
+
+// The gossip propagator shares nodes using libp2p gossipsub instead of
+// sending inventory messages to every peer.
+// Each top level node has its own channel so that peers only relay discussions they follow.
+type GossipPropagator struct {
+	sync.Mutex
+	ctx          context.Context
+	cancel       context.CancelFunc
+	self         peer.ID
+	pubsub       *pubsub.PubSub
+	topics       map[string]*pubsub.Topic
+	localStorage *storage.StorageModule
+	peerScores   *PeerScoreTracker
+	onNode       gossipNodeHandler
+}
+
+func NewGossipPropagator(ctx context.Context, h host.Host, sm *storage.StorageModule, scores *PeerScoreTracker, onNode gossipNodeHandler) (*GossipPropagator, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	ps, err := pubsub.NewGossipSub(ctx, h,
+		pubsub.WithMessageIdFn(gossipMessageID),
+		pubsub.WithPeerScore(gossipScoreParams(scores), gossipScoreThresholds()),
+		pubsub.WithMaxMessageSize(maxGossipMessageSize),
+	)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	g := &GossipPropagator{
+		ctx:          ctx,
+		cancel:       cancel,
+		self:         h.ID(),
+		pubsub:       ps,
+		topics:       make(map[string]*pubsub.Topic),
+		localStorage: sm,
+		peerScores:   scores,
+		onNode:       onNode,
+	}
+	// Follow new topics and every discussion known locally
+	if _, err := g.join(rootGossipTopic); err != nil {
+		cancel()
+		return nil, err
+	}
+	for _, n := range sm.GetTopLevelNodes() {
+		if n != nil {
+			g.join(gossipTopicFor(n.GetFingerprint()))
+		}
+	}
+	return g, nil
+}
+
+// Publish a node created locally on the channel of its discussion
+func (g *GossipPropagator) Publish(n *storage.Node) {
+	name := rootGossipTopic
+	if n.DatObj.Parent == (security.HashSignature{}) {
+		// Follow replies to the new topic
+		g.join(gossipTopicFor(n.GetFingerprint()))
+	} else if root, ok := g.localStorage.GetTopLevelAncestor(n); ok {
+		name = gossipTopicFor(root)
+	}
+	topic, err := g.join(name)
+	if err != nil {
+		return
+	}
+	id := n.GetFingerprint()
+	configuration.Logger.Info("publishing node on gossip channel:", id[0:4])
+	if err := topic.Publish(g.ctx, n.GetBytes()); err != nil {
+		configuration.Logger.Error("failed to publish node on gossip channel:", err.Error())
+	}
+}
+
+func (g *GossipPropagator) Close() {
+	g.cancel()
+}
+
+// Join and subscribe to a channel if not done yet
+func (g *GossipPropagator) join(name string) (*pubsub.Topic, error) {
+	g.Lock()
+	defer g.Unlock()
+	if topic, ok := g.topics[name]; ok {
+		return topic, nil
+	}
+	if err := g.pubsub.RegisterTopicValidator(name, g.validate); err != nil {
+		configuration.Logger.Error("failed to register gossip validator:", err.Error())
+		return nil, err
+	}
+	topic, err := g.pubsub.Join(name)
+	if err != nil {
+		configuration.Logger.Error("failed to join gossip channel:", err.Error())
+		return nil, err
+	}
+	if err := topic.SetScoreParams(gossipTopicScoreParams()); err != nil {
+		configuration.Logger.Error("failed to set gossip channel score parameters:", err.Error())
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		configuration.Logger.Error("failed to subscribe to gossip channel:", err.Error())
+		return nil, err
+	}
+	g.topics[name] = topic
+	go g.readLoop(sub)
+	return topic, nil
+}
+
+func (g *GossipPropagator) readLoop(sub *pubsub.Subscription) {
+	defer sub.Cancel()
+	for {
+		msg, err := sub.Next(g.ctx)
+		if err != nil {
+			return
+		}
+		if msg.ReceivedFrom == g.self {
+			continue
+		}
+		node := storage.ParseNode(msg.Data)
+		if node == nil || g.localStorage.NodeExists(node.GetFingerprint()) {
+			continue
+		}
+		g.onNode(node, msg.ReceivedFrom)
+	}
+}
+
+// Only relay nodes passing security verifications, invalid messages lower the sender's score
+func (g *GossipPropagator) validate(_ context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+	if from == g.self {
+		return pubsub.ValidationAccept
+	}
+	node := storage.ParseNode(msg.Data)
+	if node == nil || !node.Verify() {
+		configuration.Logger.Error("rejected invalid node from gossip peer:", from.ShortString())
+		g.peerScores.Record(from, FailedVerification)
+		return pubsub.ValidationReject
+	}
+	return pubsub.ValidationAccept
+}
+
+func gossipTopicFor(root security.HashSignature) string {
+	return gossipTopicPrefix + "topic/" + base64.URLEncoding.EncodeToString(root[:])
+}
+
+// Messages are identified by the fingerprint of the node they carry
+func gossipMessageID(msg *pb.Message) string {
+	node := storage.ParseNode(msg.GetData())
+	if node == nil {
+		return pubsub.DefaultMsgIdFn(msg)
+	}
+	id := node.GetFingerprint()
+	return string(id[:])
+}
+
+// The reputation of peers on the forum protocol also counts towards their gossip score
+func gossipScoreParams(scores *PeerScoreTracker) *pubsub.PeerScoreParams {
+	return &pubsub.PeerScoreParams{
+		Topics:                    make(map[string]*pubsub.TopicScoreParams),
+		AppSpecificScore:          scores.Score,
+		AppSpecificWeight:         1,
+		BehaviourPenaltyWeight:    -10,
+		BehaviourPenaltyThreshold: 6,
+		BehaviourPenaltyDecay:     pubsub.ScoreParameterDecay(time.Hour),
+		DecayInterval:             pubsub.DefaultDecayInterval,
+		DecayToZero:               pubsub.DefaultDecayToZero,
+		RetainScore:               time.Hour,
+	}
+}
+
+func gossipTopicScoreParams() *pubsub.TopicScoreParams {
+	// Forum traffic is sparse, so peers are not penalised for quiet meshes
+	return &pubsub.TopicScoreParams{
+		TopicWeight:                    1,
+		TimeInMeshWeight:               0.01,
+		TimeInMeshQuantum:              time.Second,
+		TimeInMeshCap:                  10,
+		FirstMessageDeliveriesWeight:   1,
+		FirstMessageDeliveriesDecay:    pubsub.ScoreParameterDecay(time.Hour),
+		FirstMessageDeliveriesCap:      100,
+		InvalidMessageDeliveriesWeight: -100,
+		InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+	}
+}
+
+func gossipScoreThresholds() *pubsub.PeerScoreThresholds {
+	return &pubsub.PeerScoreThresholds{
+		GossipThreshold:             -500,
+		PublishThreshold:            -1000,
+		GraylistThreshold:           -2500,
+		AcceptPXThreshold:           10,
+		OpportunisticGraftThreshold: 5,
+	}
+}
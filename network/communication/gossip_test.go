@@ -0,0 +1,102 @@
+package communication_test
+
+import (
+	"context"
+	"dforum-app/network/communication"
+	"dforum-app/storage"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/network"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/spf13/viper"
+)
+
+// Compare the streams opened by direct and gossipsub propagation
+// when a node is shared with a fully connected mock network.
+// Gossipsub reuses the streams of its mesh where direct propagation opens one per peer.
+func TestPropagationModes(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	previous := viper.Get("security.proofofwork-level")
+	viper.Set("security.proofofwork-level", 16)
+	t.Cleanup(func() { viper.Set("security.proofofwork-level", previous) })
+
+	streams := map[bool]int64{}
+	for _, gossip := range []bool{false, true} {
+		name := "direct"
+		if gossip {
+			name = "gossipsub"
+		}
+		t.Run(name, func(t *testing.T) {
+			streams[gossip] = propagateOnMockNetwork(t, 8, gossip)
+			t.Logf("%s propagation opened %d streams", name, streams[gossip])
+		})
+	}
+	if streams[true] >= streams[false] {
+		t.Fatalf("gossipsub should open fewer streams than direct propagation: %d >= %d", streams[true], streams[false])
+	}
+}
+
+func propagateOnMockNetwork(t *testing.T, size int, gossip bool) int64 {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn := mocknet.New(ctx)
+
+	var streams int64
+	counter := &network.NotifyBundle{
+		OpenedStreamF: func(network.Network, network.Stream) { atomic.AddInt64(&streams, 1) },
+	}
+	storageModules := []*storage.StorageModule{}
+	for i := 0; i < size; i++ {
+		// Generated mock peers use fake keys that cannot sign gossip messages
+		priv, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+		addr, _ := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", 9000+i))
+		h, err := mn.AddPeer(priv, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := fmt.Sprintf("../../test/mocknet%d/", i)
+		os.RemoveAll(path)
+		sM := storage.NewStorageModule(path)
+		defer sM.TearDown()
+		cM := communication.NewCommunicationManager(sM)
+		cM.SetHost(h, ctx)
+		h.SetStreamHandler(cM.GetProtocolID(), cM.GetMessageHandler())
+		if gossip {
+			if err := cM.EnableGossipSub(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		h.Network().Notify(counter)
+		storageModules = append(storageModules, sM)
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second) // Let gossipsub build its mesh
+
+	atomic.StoreInt64(&streams, 0)
+	root := storage.NewNode("Topic", "detail", 5, [28]byte{})
+	storageModules[0].StoreAndRegisterNewNode(root)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, sM := range storageModules {
+		for !sM.NodeExists(root.GetFingerprint()) {
+			if time.Now().After(deadline) {
+				t.Fatal("node did not reach every peer")
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	return atomic.LoadInt64(&streams)
+}
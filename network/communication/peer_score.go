@@ -0,0 +1,225 @@
+package communication
+
+import (
+	"dforum-app/configuration"
+	"dforum-app/storage"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/control"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const (
+	banThreshold   = -100.0
+	banDuration    = time.Hour
+	scoreHalfLife  = 30 * time.Minute // Scores decay towards zero so that past behaviour is forgotten
+	maxScoreReward = 100.0
+	// Scores closer to zero than this are neutral and forgotten, checked at most once per prune interval
+	neutralScore  = 0.5
+	pruneInterval = 10 * time.Minute
+)
+
+// Behaviours of peers affecting their score
+type PeerEvent uint
+
+const (
+	InvalidFrame PeerEvent = iota
+	FailedVerification
+	RequestTimeout
+	OversizedPayload
+	UsefulNode
+)
+
+func (e PeerEvent) String() string {
+	eventNames := [...]string{
+		"InvalidFrame",
+		"FailedVerification",
+		"RequestTimeout",
+		"OversizedPayload",
+		"UsefulNode",
+	}
+	if int(e) >= len(eventNames) {
+		return "Unknown peer event."
+	}
+	return eventNames[e]
+}
+
+func (e PeerEvent) score() float64 {
+	eventScores := [...]float64{
+		-10, // InvalidFrame
+		-25, // FailedVerification
+		-2,  // RequestTimeout
+		-20, // OversizedPayload
+		1,   // UsefulNode
+	}
+	if int(e) >= len(eventScores) {
+		return 0
+	}
+	return eventScores[e]
+}
+
+type peerScore struct {
+	value   float64
+	updated time.Time
+}
+
+// Score of a peer exposed for diagnostics
+type PeerScoreInfo struct {
+	Peer        string
+	Score       float64
+	BannedUntil time.Time
+}
+
+// The peer score tracker accumulates penalties and rewards for each peer.
+// Peers whose score drops below the ban threshold are disconnected and
+// refused by the connection gater until their ban, persisted in storage, ends.
+type PeerScoreTracker struct {
+	sync.Mutex
+	scores       map[peer.ID]*peerScore
+	bans         map[peer.ID]time.Time
+	lastPrune    time.Time
+	host         host.Host
+	localStorage *storage.StorageModule
+}
+
+func NewPeerScoreTracker(sm *storage.StorageModule) *PeerScoreTracker {
+	t := &PeerScoreTracker{
+		scores:       make(map[peer.ID]*peerScore),
+		bans:         make(map[peer.ID]time.Time),
+		localStorage: sm,
+	}
+	// Restore bans from previous sessions
+	for v, until := range sm.GetBans() {
+		p, err := peer.Decode(v)
+		if err != nil || time.Now().After(until) {
+			sm.DeleteBan(v)
+			continue
+		}
+		t.bans[p] = until
+	}
+	return t
+}
+
+// Set the host used to disconnect banned peers
+func (t *PeerScoreTracker) SetHost(h host.Host) {
+	t.Lock()
+	defer t.Unlock()
+	t.host = h
+}
+
+// Update the score of a peer following one of its behaviours, banning it if needed
+func (t *PeerScoreTracker) Record(p peer.ID, event PeerEvent) {
+	t.Lock()
+	defer t.Unlock()
+	value := math.Min(t.getScore(p)+event.score(), maxScoreReward)
+	t.scores[p] = &peerScore{value: value, updated: time.Now()}
+	if event.score() < 0 {
+		configuration.Logger.Infof("peer %s penalised for %s, score: %.1f", p.ShortString(), event, value)
+	}
+	if value <= banThreshold {
+		t.ban(p)
+	}
+	t.prune()
+}
+
+// Score of a peer, 0 for peers without recorded behaviour
+func (t *PeerScoreTracker) Score(p peer.ID) float64 {
+	t.Lock()
+	defer t.Unlock()
+	return t.getScore(p)
+}
+
+func (t *PeerScoreTracker) IsBanned(p peer.ID) bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.isBanned(p)
+}
+
+func (t *PeerScoreTracker) GetScores() []PeerScoreInfo {
+	t.Lock()
+	defer t.Unlock()
+	infos := []PeerScoreInfo{}
+	for p := range t.scores {
+		infos = append(infos, PeerScoreInfo{Peer: p.String(), Score: t.getScore(p)})
+	}
+	for p, until := range t.bans {
+		infos = append(infos, PeerScoreInfo{Peer: p.String(), Score: banThreshold, BannedUntil: until})
+	}
+	return infos
+}
+
+// Get the score of a peer after applying its decay, must hold the lock
+func (t *PeerScoreTracker) getScore(p peer.ID) float64 {
+	score, ok := t.scores[p]
+	if !ok {
+		return 0
+	}
+	elapsed := time.Since(score.updated)
+	return score.value * math.Exp2(-float64(elapsed)/float64(scoreHalfLife))
+}
+
+// Forget the scores that decayed to neutral, must hold the lock
+func (t *PeerScoreTracker) prune() {
+	if time.Since(t.lastPrune) < pruneInterval {
+		return
+	}
+	t.lastPrune = time.Now()
+	for p := range t.scores {
+		if math.Abs(t.getScore(p)) < neutralScore {
+			delete(t.scores, p)
+		}
+	}
+}
+
+func (t *PeerScoreTracker) isBanned(p peer.ID) bool {
+	until, ok := t.bans[p]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(t.bans, p)
+		t.localStorage.DeleteBan(p.String())
+		return false
+	}
+	return true
+}
+
+func (t *PeerScoreTracker) ban(p peer.ID) {
+	until := time.Now().Add(banDuration)
+	configuration.Logger.Errorf("banning peer %s until %s", p.ShortString(), until.Format(time.RFC822Z))
+	delete(t.scores, p)
+	t.bans[p] = until
+	t.localStorage.StoreBan(p.String(), until)
+	if t.host != nil {
+		go t.host.Network().ClosePeer(p)
+	}
+}
+
+/*
+	Connection gater, refuses any connection with banned peers
+*/
+
+func (t *PeerScoreTracker) InterceptPeerDial(p peer.ID) bool {
+	return !t.IsBanned(p)
+}
+
+func (t *PeerScoreTracker) InterceptAddrDial(p peer.ID, _ multiaddr.Multiaddr) bool {
+	return !t.IsBanned(p)
+}
+
+func (t *PeerScoreTracker) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true // The peer is only known once the connection is secured
+}
+
+func (t *PeerScoreTracker) InterceptSecured(_ network.Direction, p peer.ID, _ network.ConnMultiaddrs) bool {
+	return !t.IsBanned(p)
+}
+
+func (t *PeerScoreTracker) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
@@ -0,0 +1,63 @@
+package communication
+
+import (
+	"dforum-app/storage"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/test"
+)
+
+func TestPeerBannedAfterPenalties(t *testing.T) {
+	os.RemoveAll("../../test/scores/")
+	sM := storage.NewStorageModule("../../test/scores/")
+	defer sM.TearDown()
+	tracker := NewPeerScoreTracker(sM)
+
+	p, _ := test.RandPeerID()
+	tracker.Record(p, UsefulNode)
+	if tracker.Score(p) <= 0 {
+		t.Fatal("useful nodes should be rewarded")
+	}
+	for i := 0; i < 5; i++ {
+		tracker.Record(p, FailedVerification)
+	}
+	if !tracker.IsBanned(p) {
+		t.Fatal("peer should have been banned")
+	}
+	if tracker.InterceptPeerDial(p) || tracker.InterceptSecured(0, p, nil) {
+		t.Fatal("connections with banned peers should be refused")
+	}
+
+	// Bans are restored after a restart
+	if !NewPeerScoreTracker(sM).IsBanned(p) {
+		t.Fatal("ban should be persisted")
+	}
+}
+
+func TestPeerScoreDecay(t *testing.T) {
+	os.RemoveAll("../../test/scores/")
+	sM := storage.NewStorageModule("../../test/scores/")
+	defer sM.TearDown()
+	tracker := NewPeerScoreTracker(sM)
+
+	p, _ := test.RandPeerID()
+	tracker.Record(p, InvalidFrame)
+	tracker.scores[p].updated = time.Now().Add(-scoreHalfLife)
+	if score := tracker.Score(p); score < InvalidFrame.score()/2-0.1 || score > InvalidFrame.score()/2+0.1 {
+		t.Fatalf("score should be halved after a half life, got %f", score)
+	}
+
+	// Looking scores up does not record peers, and neutral scores are forgotten
+	other, _ := test.RandPeerID()
+	if tracker.Score(other) != 0 || len(tracker.scores) != 1 {
+		t.Fatal("unknown peers should not be recorded when their score is read")
+	}
+	tracker.scores[p].updated = time.Now().Add(-10 * scoreHalfLife)
+	tracker.lastPrune = time.Time{}
+	tracker.Record(other, UsefulNode)
+	if _, ok := tracker.scores[p]; ok || len(tracker.scores) != 1 {
+		t.Fatal("decayed scores should be pruned")
+	}
+}
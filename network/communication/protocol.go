@@ -5,6 +5,7 @@ import (
 	"context"
 	"dforum-app/configuration"
 	"dforum-app/security"
+	"dforum-app/storage"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -20,6 +21,16 @@ import (
 
 const MessageProtocol = protocol.ID("/libp2p/DDF/0.0.1")
 
+// Max size of responses read from peers
+const (
+	maxNodeResponseSize = 1 << 16
+	maxSyncResponseSize = 1 << 22
+	// Chunks are checked against their hash, the largest response is a full chunk
+	maxChunkResponseSize = storage.AttachmentChunkSize
+)
+
+var errOversizedPayload = errors.New("payload exceeds the maximum size")
+
 // Inspired by: https://github.com/aethereans/aether-app
 type ProtocolAction uint
 
@@ -29,6 +40,8 @@ func (a ProtocolAction) String() string {
 		"SyncRequest",
 		"InventoryMessage",
 		"DataRequest",
+		"Throttled",
+		"ChunkRequest",
 		// This set has to match the set in const() and its order.
 	}
 	if !a.isValid() {
@@ -38,7 +51,7 @@ func (a ProtocolAction) String() string {
 }
 
 func (a ProtocolAction) isValid() bool {
-	return InvalidMessage <= a && a <= DataRequest
+	return InvalidMessage <= a && a <= ChunkRequest
 }
 
 // Available actions matching action codes above
@@ -47,6 +60,8 @@ const (
 	SyncRequest
 	InventoryMessage
 	DataRequest
+	Throttled // Response to requests exceeding the rate limits of a peer
+	ChunkRequest
 )
 
 func parseActionByte(actionCode byte) ProtocolAction {
@@ -65,29 +80,49 @@ func messageHandler(cm *CommunicationManager, s network.Stream) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	defer s.Close()
-	configuration.Logger.Info(s.ID(), "- new stream from:", s.Conn().RemotePeer().ShortString())
+	remote := s.Conn().RemotePeer()
+	if cm.peerScores.IsBanned(remote) {
+		s.Reset()
+		return
+	}
+	if !cm.rateLimiter.AcquireHandler() {
+		configuration.Logger.Info(s.ID(), "too many messages in flight, throttling peer:", remote.ShortString())
+		sendThrottledMessage(s)
+		return
+	}
+	defer cm.rateLimiter.ReleaseHandler()
+	configuration.Logger.Info(s.ID(), "- new stream from:", remote.ShortString())
 	metaSize := 3
 	meta := make([]byte, metaSize)
 	err := readFromStreamWithContext(ctx, meta, s, metaSize)
 	if err != nil {
 		configuration.Logger.Error(s.ID(), "failed to handle message header:", err.Error())
+		cm.peerScores.Record(remote, readFailureEvent(err))
 		return
 	}
 	action := parseActionByte(meta[0])
 	if action == InvalidMessage {
 		configuration.Logger.Info(s.ID(), "peer sent an InvalidMessage message")
+		cm.peerScores.Record(remote, InvalidFrame)
 		return
 	}
 	contentSize := binary.BigEndian.Uint16(meta[1:])
 	// The following actions require data
 	if contentSize <= 0 {
+		cm.peerScores.Record(remote, InvalidFrame)
 		sendInvalidMessage(s)
 		return
 	}
+	if !cm.rateLimiter.Allow(remote, action) {
+		configuration.Logger.Info(s.ID(), "rate limit exceeded for", action, "from:", remote.ShortString())
+		sendThrottledMessage(s)
+		return
+	}
 	content := make([]byte, contentSize)
-	readFromStreamWithContext(ctx, content, s, int(contentSize))
+	err = readFromStreamWithContext(ctx, content, s, int(contentSize))
 	if err != nil {
 		configuration.Logger.Error(s.ID(), "failed to handle message body:", err.Error())
+		cm.peerScores.Record(remote, readFailureEvent(err))
 		return
 	}
 	switch action {
@@ -97,12 +132,25 @@ func messageHandler(cm *CommunicationManager, s network.Stream) {
 		cm.handleInventoryMessage(content, s)
 	case DataRequest:
 		cm.handleDataRequest(content, s)
+	case ChunkRequest:
+		cm.handleChunkRequest(content, s)
 	default:
 		configuration.Logger.Error(s.ID(), "message received did not conform to the communication protocol")
 		return
 	}
 }
 
+// Classify a failure to read from a peer for its score
+func readFailureEvent(err error) PeerEvent {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return RequestTimeout
+	}
+	if errors.Is(err, errOversizedPayload) {
+		return OversizedPayload
+	}
+	return InvalidFrame
+}
+
 func readFromStreamWithContext(ctx context.Context, buffer []byte, s network.Stream, size int) error {
 	readDone := make(chan error, 1)
 	go func() {
@@ -122,18 +170,22 @@ func readFromStreamWithContext(ctx context.Context, buffer []byte, s network.Str
 	}
 }
 
-func readAllFromStreamWithContext(ctx context.Context, s network.Stream) ([]byte, error) {
+// Read a whole response, failing if it is larger than maxSize bytes
+func readAllFromStreamWithContext(ctx context.Context, s network.Stream, maxSize int64) ([]byte, error) {
 	readDone := make(chan error, 1)
 	var data []byte
 	go func() {
 		var err error
-		data, err = io.ReadAll(s)
+		data, err = io.ReadAll(io.LimitReader(s, maxSize+1))
+		if err == nil && int64(len(data)) > maxSize {
+			err = errOversizedPayload
+		}
 		readDone <- err
 	}()
 
 	select {
 	case <-ctx.Done():
-		return data, ctx.Err()
+		return nil, ctx.Err()
 	case err := <-readDone:
 		return data, err
 	}
@@ -159,8 +211,23 @@ func sendInvalidMessage(s network.Stream) error {
 	return simpleSend(msg, s)
 }
 
+func sendThrottledMessage(s network.Stream) error {
+	msg := []byte{byte(Throttled)}
+	return simpleSend(msg, s)
+}
+
+// Peers respond with a Throttled message when requests exceed their rate limits
+func isThrottledMessage(response []byte) bool {
+	return len(response) == 1 && response[0] == byte(Throttled)
+}
+
+// Peers respond with an InvalidMessage when they cannot serve a request
+func isInvalidMessage(response []byte) bool {
+	return len(response) == 1 && response[0] == byte(InvalidMessage)
+}
+
 // https://github.com/libp2p/go-libp2p/blob/master/examples/chat-with-mdns/main.go
-func sendRequestWithResponse(msg []byte, s network.Stream) ([]byte, error) {
+func sendRequestWithResponse(msg []byte, s network.Stream, maxSize int64) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
 	defer cancel()
 	defer s.Close()
@@ -169,7 +236,7 @@ func sendRequestWithResponse(msg []byte, s network.Stream) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	data, err := readAllFromStreamWithContext(ctx, s)
+	data, err := readAllFromStreamWithContext(ctx, s, maxSize)
 	if err != nil {
 		return nil, err
 	}
@@ -179,6 +246,12 @@ func sendRequestWithResponse(msg []byte, s network.Stream) ([]byte, error) {
 	return nil, nil
 }
 
+// Whether a peer announced the message protocol, peers only serving the DHT or relays do not
+func SupportsMessageProtocol(h host.Host, p peer.ID) bool {
+	protocols, err := h.Peerstore().SupportsProtocols(p, string(MessageProtocol))
+	return err == nil && len(protocols) > 0
+}
+
 func broadcastToAllPeers(msg []byte, host host.Host, ctx context.Context) {
 	for _, peer := range host.Network().Peers() {
 		if _, err := host.Peerstore().SupportsProtocols(peer, string(MessageProtocol)); err == nil {
@@ -207,6 +280,15 @@ func getPeerStream(peer peer.ID, host host.Host, ctx context.Context) (network.S
 	return nil, err
 }
 
+// Chunk requests hold the hash of an attachment followed by the index of the chunk
+func getChunkFromMessage(msg []byte) (security.HashSignature, int, error) {
+	if len(msg) != 28+4 {
+		return security.HashSignature{}, 0, errors.New("invalid msg length provided")
+	}
+	hash, _ := getHashSignatureFromMessage(msg[:28])
+	return hash, int(binary.BigEndian.Uint32(msg[28:])), nil
+}
+
 func getHashSignatureFromMessage(msg []byte) (security.HashSignature, error) {
 	if len(msg) != 28 { // Signatures are 28 bytes in length, include integration test for this
 		return security.HashSignature{}, errors.New("invalid msg length provided")
@@ -238,3 +320,10 @@ func BuildInventoryMessage(id security.HashSignature) []byte {
 func BuildDataRequestMsg(id security.HashSignature) []byte {
 	return append(buildSimpleActionMessage(DataRequest, uint16(len(id))), (id[:])...)
 }
+
+func BuildChunkRequestMsg(attachment security.HashSignature, index int) []byte {
+	content := make([]byte, 28+4)
+	copy(content, attachment[:])
+	binary.BigEndian.PutUint32(content[28:], uint32(index))
+	return append(buildSimpleActionMessage(ChunkRequest, uint16(len(content))), content...)
+}
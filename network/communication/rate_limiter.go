@@ -0,0 +1,147 @@
+package communication
+
+import (
+	"dforum-app/configuration"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	throttleBackoff   = 30 * time.Second // Delay before sending requests again to a peer that throttled us
+	bucketIdleTimeout = 10 * time.Minute // Buckets of peers idle for this long are forgotten
+)
+
+// Token bucket refilled at a constant rate up to its burst size
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) bool {
+	b.tokens = math.Min(b.tokens+now.Sub(b.updated).Seconds()*rate, float64(burst))
+	b.updated = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+type bucketKey struct {
+	peer   peer.ID
+	action ProtocolAction
+}
+
+// The rate limiter protects the node from peers flooding it with requests.
+// Each peer has a token bucket per action type and the number of messages
+// handled at the same time is capped. It also remembers which peers throttled
+// us so that outgoing requests back off.
+type RateLimiter struct {
+	sync.Mutex
+	limits     map[ProtocolAction]rateLimit
+	buckets    map[bucketKey]*tokenBucket
+	handlers   chan struct{}
+	backoffs   map[peer.ID]time.Time
+	lastPruned time.Time
+}
+
+func NewRateLimiter() *RateLimiter {
+	syncRate, syncBurst := configuration.GetSyncRequestLimit()
+	invRate, invBurst := configuration.GetInventoryLimit()
+	dataRate, dataBurst := configuration.GetDataRequestLimit()
+	chunkRate, chunkBurst := configuration.GetChunkRequestLimit()
+	return &RateLimiter{
+		limits: map[ProtocolAction]rateLimit{
+			SyncRequest:      {syncRate, syncBurst},
+			InventoryMessage: {invRate, invBurst},
+			DataRequest:      {dataRate, dataBurst},
+			ChunkRequest:     {chunkRate, chunkBurst},
+		},
+		buckets:    make(map[bucketKey]*tokenBucket),
+		handlers:   make(chan struct{}, configuration.GetMaxConcurrentHandlers()),
+		backoffs:   make(map[peer.ID]time.Time),
+		lastPruned: time.Now(),
+	}
+}
+
+// Check whether a message from a peer is within its limits, consuming a token if so
+func (rl *RateLimiter) Allow(p peer.ID, action ProtocolAction) bool {
+	limit, ok := rl.limits[action]
+	if !ok {
+		return true
+	}
+	rl.Lock()
+	defer rl.Unlock()
+	now := time.Now()
+	rl.prune(now)
+	key := bucketKey{p, action}
+	bucket, ok := rl.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.burst), updated: now}
+		rl.buckets[key] = bucket
+	}
+	return bucket.take(now, limit.rate, limit.burst)
+}
+
+// Reserve a slot to handle a message, returns false if too many are in flight
+func (rl *RateLimiter) AcquireHandler() bool {
+	select {
+	case rl.handlers <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (rl *RateLimiter) ReleaseHandler() {
+	<-rl.handlers
+}
+
+// Record that a peer throttled one of our requests
+func (rl *RateLimiter) BackOff(p peer.ID) {
+	rl.Lock()
+	defer rl.Unlock()
+	configuration.Logger.Info("peer throttled our request, backing off:", p.ShortString())
+	rl.backoffs[p] = time.Now().Add(throttleBackoff)
+}
+
+// Check whether requests to a peer should wait after it throttled us
+func (rl *RateLimiter) IsBackingOff(p peer.ID) bool {
+	rl.Lock()
+	defer rl.Unlock()
+	until, ok := rl.backoffs[p]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(rl.backoffs, p)
+		return false
+	}
+	return true
+}
+
+// Forget the buckets of idle peers, must hold the lock
+func (rl *RateLimiter) prune(now time.Time) {
+	if now.Sub(rl.lastPruned) < bucketIdleTimeout {
+		return
+	}
+	rl.lastPruned = now
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.updated) > bucketIdleTimeout {
+			delete(rl.buckets, key)
+		}
+	}
+	for p, until := range rl.backoffs {
+		if now.After(until) {
+			delete(rl.backoffs, p)
+		}
+	}
+}
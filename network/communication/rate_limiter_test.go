@@ -0,0 +1,46 @@
+package communication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/test"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := &tokenBucket{tokens: 2, updated: now}
+	if !b.take(now, 1, 2) || !b.take(now, 1, 2) {
+		t.Fatal("burst should be allowed")
+	}
+	if b.take(now, 1, 2) {
+		t.Fatal("empty bucket should refuse")
+	}
+	if !b.take(now.Add(time.Second), 1, 2) {
+		t.Fatal("bucket should refill over time")
+	}
+	if !b.take(now.Add(time.Hour), 1, 2) || !b.take(now.Add(time.Hour), 1, 2) || b.take(now.Add(time.Hour), 1, 2) {
+		t.Fatal("bucket should not refill beyond its burst")
+	}
+}
+
+func TestRateLimitsPerPeerAndAction(t *testing.T) {
+	rl := NewRateLimiter()
+	p1, _ := test.RandPeerID()
+	p2, _ := test.RandPeerID()
+	burst := rl.limits[SyncRequest].burst
+	for i := 0; i < burst; i++ {
+		if !rl.Allow(p1, SyncRequest) {
+			t.Fatal("requests within the burst should be allowed")
+		}
+	}
+	if rl.Allow(p1, SyncRequest) {
+		t.Fatal("requests beyond the burst should be throttled")
+	}
+	if !rl.Allow(p2, SyncRequest) {
+		t.Fatal("limits should apply per peer")
+	}
+	if !rl.Allow(p1, DataRequest) {
+		t.Fatal("limits should apply per action")
+	}
+}
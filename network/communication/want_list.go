@@ -0,0 +1,211 @@
+package communication
+
+import (
+	"dforum-app/configuration"
+	"dforum-app/security"
+	"dforum-app/storage"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	wantBaseBackoff = 2 * time.Second
+	wantMaxBackoff  = 10 * time.Minute
+	wantMaxAttempts = 30 // Wants are dropped after this many failed fetches
+	wantMaxInFlight = 8  // Max concurrent data requests for wants
+	// Max number of missing ancestors fetched above a received node
+	maxAncestorDepth = 32
+)
+
+// A node hash announced by peers that has not been fetched yet
+type want struct {
+	peers       []peer.ID // Peers known to have the node
+	attempts    int
+	nextAttempt time.Time
+	inFlight    bool
+	depth       int // Distance from the node that led to this want, 0 if announced directly
+}
+
+// Snapshot of a want used to inspect the queue
+type WantInfo struct {
+	ID          string
+	Peers       []string
+	Attempts    int
+	NextAttempt time.Time
+	InFlight    bool
+}
+
+// A scheduled fetch of a wanted node from a given peer
+type wantTask struct {
+	id    security.HashSignature
+	peer  peer.ID
+	depth int
+}
+
+// The want list records every unknown node hash with the peers that announced it.
+// Fetches are scheduled with an exponential backoff, rotating through known peers,
+// and pending wants are persisted in storage to survive restarts.
+type WantList struct {
+	sync.Mutex
+	wants        map[security.HashSignature]*want
+	localStorage *storage.StorageModule
+}
+
+func NewWantList(sm *storage.StorageModule) *WantList {
+	wl := &WantList{
+		wants:        make(map[security.HashSignature]*want),
+		localStorage: sm,
+	}
+	// Load wants persisted during previous sessions
+	for id, peerStrings := range sm.GetWants() {
+		if sm.NodeExists(id) {
+			sm.DeleteWant(id)
+			continue
+		}
+		w := &want{}
+		for _, v := range peerStrings {
+			p, err := peer.Decode(v)
+			if err != nil {
+				configuration.Logger.Error("could not parse peer of persisted want:", err.Error())
+				continue
+			}
+			w.peers = append(w.peers, p)
+		}
+		if len(w.peers) == 0 {
+			sm.DeleteWant(id)
+			continue
+		}
+		wl.wants[id] = w
+	}
+	return wl
+}
+
+// Record that a peer has a given node.
+// Returns true if the want or the peer were not known before.
+func (wl *WantList) Add(id security.HashSignature, p peer.ID) bool {
+	return wl.add(id, p, 0)
+}
+
+// Record the missing ancestor of a received node, depth being its distance to that node.
+func (wl *WantList) AddAncestor(id security.HashSignature, p peer.ID, depth int) bool {
+	return wl.add(id, p, depth)
+}
+
+func (wl *WantList) add(id security.HashSignature, p peer.ID, depth int) bool {
+	wl.Lock()
+	defer wl.Unlock()
+	w, ok := wl.wants[id]
+	if !ok {
+		w = &want{nextAttempt: time.Now(), depth: depth}
+		wl.wants[id] = w
+	} else if depth < w.depth {
+		w.depth = depth
+	}
+	for _, v := range w.peers {
+		if v == p {
+			return false
+		}
+	}
+	w.peers = append(w.peers, p)
+	wl.persist(id, w)
+	return true
+}
+
+// Remove a want once its node is stored or no longer needed
+func (wl *WantList) Remove(id security.HashSignature) {
+	wl.Lock()
+	defer wl.Unlock()
+	if _, ok := wl.wants[id]; !ok {
+		return
+	}
+	delete(wl.wants, id)
+	wl.localStorage.DeleteWant(id)
+}
+
+// Register a failed fetch and schedule the next attempt with backoff.
+// Wants that keep failing are eventually dropped.
+func (wl *WantList) Failed(id security.HashSignature) {
+	wl.Lock()
+	defer wl.Unlock()
+	w, ok := wl.wants[id]
+	if !ok {
+		return
+	}
+	w.inFlight = false
+	w.attempts++
+	if w.attempts >= wantMaxAttempts {
+		configuration.Logger.Errorf("dropping want %s after %d failed attempts", id[0:4], w.attempts)
+		delete(wl.wants, id)
+		wl.localStorage.DeleteWant(id)
+		return
+	}
+	w.nextAttempt = time.Now().Add(wantBackoff(w.attempts))
+}
+
+// Select wants due for a fetch, marking them as in flight.
+// Each attempt asks the next known peer so that a flaky peer does not block a node.
+func (wl *WantList) nextDue(now time.Time, maxInFlight int) []wantTask {
+	wl.Lock()
+	defer wl.Unlock()
+	available := maxInFlight
+	for _, w := range wl.wants {
+		if w.inFlight {
+			available--
+		}
+	}
+	tasks := []wantTask{}
+	for id, w := range wl.wants {
+		if available <= 0 {
+			break
+		}
+		if w.inFlight || now.Before(w.nextAttempt) {
+			continue
+		}
+		w.inFlight = true
+		tasks = append(tasks, wantTask{id: id, peer: w.peers[w.attempts%len(w.peers)], depth: w.depth})
+		available--
+	}
+	return tasks
+}
+
+func (wl *WantList) GetWants() []WantInfo {
+	wl.Lock()
+	defer wl.Unlock()
+	infos := []WantInfo{}
+	for id, w := range wl.wants {
+		peers := []string{}
+		for _, p := range w.peers {
+			peers = append(peers, p.String())
+		}
+		infos = append(infos, WantInfo{
+			ID:          base64.URLEncoding.EncodeToString(id[:]),
+			Peers:       peers,
+			Attempts:    w.attempts,
+			NextAttempt: w.nextAttempt,
+			InFlight:    w.inFlight,
+		})
+	}
+	return infos
+}
+
+func (wl *WantList) persist(id security.HashSignature, w *want) {
+	peers := []string{}
+	for _, p := range w.peers {
+		peers = append(peers, p.String())
+	}
+	wl.localStorage.StoreWant(id, peers)
+}
+
+func wantBackoff(attempts int) time.Duration {
+	backoff := wantBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= wantMaxBackoff {
+			return wantMaxBackoff
+		}
+	}
+	return backoff
+}
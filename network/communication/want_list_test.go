@@ -0,0 +1,71 @@
+package communication
+
+import (
+	"dforum-app/security"
+	"dforum-app/storage"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/test"
+)
+
+func TestWantListRotatesPeers(t *testing.T) {
+	os.RemoveAll("../../test/wants/")
+	sM := storage.NewStorageModule("../../test/wants/")
+	defer sM.TearDown()
+	wl := NewWantList(sM)
+
+	id := security.HashSignature{1, 2, 3}
+	peerA, _ := test.RandPeerID()
+	peerB, _ := test.RandPeerID()
+	if !wl.Add(id, peerA) || !wl.Add(id, peerB) {
+		t.Fatal("expected new peers to be registered")
+	}
+	if wl.Add(id, peerA) {
+		t.Fatal("expected duplicate peer to be ignored")
+	}
+
+	tasks := wl.nextDue(time.Now(), wantMaxInFlight)
+	if len(tasks) != 1 || tasks[0].peer != peerA {
+		t.Fatalf("expected first attempt from first peer, got %v", tasks)
+	}
+	if len(wl.nextDue(time.Now(), wantMaxInFlight)) != 0 {
+		t.Fatal("in flight wants should not be scheduled twice")
+	}
+	wl.Failed(id)
+	if len(wl.nextDue(time.Now(), wantMaxInFlight)) != 0 {
+		t.Fatal("failed wants should back off")
+	}
+	tasks = wl.nextDue(time.Now().Add(wantBaseBackoff), wantMaxInFlight)
+	if len(tasks) != 1 || tasks[0].peer != peerB {
+		t.Fatalf("expected retry from alternate peer, got %v", tasks)
+	}
+}
+
+func TestWantListPersistence(t *testing.T) {
+	os.RemoveAll("../../test/wants/")
+	sM := storage.NewStorageModule("../../test/wants/")
+	defer sM.TearDown()
+
+	id := security.HashSignature{4, 5, 6}
+	p, _ := test.RandPeerID()
+	NewWantList(sM).Add(id, p)
+
+	wants := NewWantList(sM).GetWants()
+	if len(wants) != 1 || wants[0].Peers[0] != p.String() {
+		t.Fatalf("expected want to be restored from storage, got %v", wants)
+	}
+}
+
+func TestWantBackoff(t *testing.T) {
+	if wantBackoff(1) != wantBaseBackoff {
+		t.Fatal("first retry should use the base backoff")
+	}
+	if wantBackoff(3) != 4*wantBaseBackoff {
+		t.Fatal("backoff should double with each attempt")
+	}
+	if wantBackoff(wantMaxAttempts) != wantMaxBackoff {
+		t.Fatal("backoff should be capped")
+	}
+}
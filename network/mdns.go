@@ -0,0 +1,46 @@
+package network
+
+import (
+	"context"
+	"dforum-app/configuration"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+)
+
+// Service advertised on the local network, only forum peers answer to it
+const mdnsServiceName = "_dforum._udp"
+
+// Connects and syncs with forum peers found on the local network
+type mdnsNotifee struct {
+	ctx           context.Context
+	host          host.Host
+	syncScheduler *SyncScheduler
+}
+
+func (m *mdnsNotifee) HandlePeerFound(pi peer.AddrInfo) {
+	if pi.ID == m.host.ID() || m.host.Network().Connectedness(pi.ID) == network.Connected {
+		return
+	}
+	if err := m.host.Connect(m.ctx, pi); err != nil {
+		configuration.Logger.Error("connecting to local peer:", err.Error())
+		return
+	}
+	configuration.Logger.Info("connected to local peer", pi.ID.ShortString())
+	m.syncScheduler.SyncPeer(pi.ID)
+}
+
+// Discover peers on the local network, allows forums to work without any seeds configured
+func startMdnsDiscovery(ctx context.Context, h host.Host, s *SyncScheduler) (mdns.Service, error) {
+	service := mdns.NewMdnsService(h, mdnsServiceName, &mdnsNotifee{
+		ctx:           ctx,
+		host:          h,
+		syncScheduler: s,
+	})
+	if err := service.Start(); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
@@ -0,0 +1,77 @@
+package network
+
+import (
+	"context"
+	"dforum-app/network/communication"
+	"dforum-app/storage"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-tcp-transport"
+	"github.com/spf13/viper"
+)
+
+func TestMdnsDiscoveryOnLoopback(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	previous := viper.Get("security.proofofwork-level")
+	viper.Set("security.proofofwork-level", 16)
+	t.Cleanup(func() { viper.Set("security.proofofwork-level", previous) })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h1, sM1 := newLoopbackHost(t, ctx, 1)
+	// Stored before the hosts discover each other, it can only reach the other host by a sync
+	topic := storage.NewNode("Local topic", "", -1, [28]byte{})
+	sM1.StoreNode(topic)
+	h2, sM2 := newLoopbackHost(t, ctx, 2)
+	defer h1.Close()
+	defer h2.Close()
+
+	deadline := time.Now().Add(15 * time.Second)
+	for len(h1.Network().Peers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("hosts did not discover each other")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if h1.Network().Peers()[0] != h2.ID() {
+		t.Fatal("connected to an unexpected peer")
+	}
+	for !sM2.NodeExists(topic.GetFingerprint()) {
+		if time.Now().After(deadline) {
+			t.Fatal("discovered host was not synced with")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func newLoopbackHost(t *testing.T, ctx context.Context, id int) (host.Host, *storage.StorageModule) {
+	h, err := libp2p.New(
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.Transport(tcp.NewTCPTransport),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("../test/mdns%d/", id)
+	os.RemoveAll(path)
+	sM := storage.NewStorageModule(path)
+	t.Cleanup(sM.TearDown)
+	cM := communication.NewCommunicationManager(sM)
+	cM.SetHost(h, ctx)
+	h.SetStreamHandler(cM.GetProtocolID(), cM.GetMessageHandler())
+	s := NewSyncScheduler(h, cM, time.Minute, 1, 0)
+	s.Start()
+	t.Cleanup(s.Stop)
+	service, err := startMdnsDiscovery(ctx, h, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.Close() })
+	return h, sM
+}
@@ -0,0 +1,124 @@
+package network
+
+import (
+	"dforum-app/configuration"
+	"sync"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Connectivity of the host, exposed to show users whether peers can reach them
+type NetworkStatus struct {
+	PeerID         string
+	Reachability   string // Unknown, Public or Private as detected by AutoNAT
+	Addresses      []string
+	RelayAddresses []string // Addresses through relays advertised while behind a NAT
+	RelayMode      string
+	HolePunching   bool
+	Peers          int
+}
+
+// Options letting NATed hosts be reached through circuit relays and hole punching.
+// Hosts in service mode relay connections and help peers detect their reachability.
+func relayOptions(mode string, relays []peer.AddrInfo, holePunching bool) []libp2p.Option {
+	if mode == configuration.RelayModeOff {
+		return []libp2p.Option{libp2p.DisableRelay()}
+	}
+	options := []libp2p.Option{libp2p.EnableRelay()}
+	switch mode {
+	case configuration.RelayModeService:
+		options = append(options, libp2p.EnableRelayService(), libp2p.EnableNATService())
+	case configuration.RelayModeClient:
+		if len(relays) > 0 {
+			options = append(options, libp2p.EnableAutoRelay(autorelay.WithStaticRelays(relays)))
+		} else { // Relays are discovered through the DHT
+			options = append(options, libp2p.EnableAutoRelay())
+		}
+	}
+	if holePunching {
+		options = append(options, libp2p.EnableHolePunching())
+	}
+	return options
+}
+
+// Relays from the config, falling back to the seeds which run as relays
+func getStaticRelays(private bool) []peer.AddrInfo {
+	addresses := configuration.GetRelayPeers()
+	if len(addresses) == 0 {
+		addresses = configuration.GetNetworkSeeds()
+		if private {
+			addresses = configuration.GetPrivateNetworkSeeds()
+		}
+	}
+	relays := []peer.AddrInfo{}
+	for _, address := range addresses {
+		info, err := peer.AddrInfoFromString(address)
+		if err != nil {
+			configuration.Logger.Error("ignoring invalid relay address:", address)
+			continue
+		}
+		relays = append(relays, *info)
+	}
+	return relays
+}
+
+// The reachability tracker records the reachability detected by AutoNAT
+type reachabilityTracker struct {
+	sync.Mutex
+	reachability network.Reachability
+	sub          event.Subscription
+}
+
+func startReachabilityTracker(h host.Host) (*reachabilityTracker, error) {
+	sub, err := h.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+	if err != nil {
+		return nil, err
+	}
+	t := &reachabilityTracker{sub: sub}
+	go func() {
+		for e := range sub.Out() {
+			evt := e.(event.EvtLocalReachabilityChanged)
+			configuration.Logger.Info("reachability changed:", evt.Reachability.String())
+			t.Lock()
+			t.reachability = evt.Reachability
+			t.Unlock()
+		}
+	}()
+	return t, nil
+}
+
+func (t *reachabilityTracker) Get() network.Reachability {
+	t.Lock()
+	defer t.Unlock()
+	return t.reachability
+}
+
+func (t *reachabilityTracker) Close() {
+	t.sub.Close()
+}
+
+func getNetworkStatus(h host.Host, reachability network.Reachability) NetworkStatus {
+	status := NetworkStatus{
+		PeerID:         h.ID().String(),
+		Reachability:   reachability.String(),
+		Addresses:      []string{},
+		RelayAddresses: []string{},
+		RelayMode:      configuration.GetRelayMode(),
+		HolePunching:   configuration.IsHolePunchingEnabled(),
+		Peers:          len(h.Network().Peers()),
+	}
+	for _, addr := range h.Addrs() {
+		if _, err := addr.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+			status.RelayAddresses = append(status.RelayAddresses, addr.String())
+		} else {
+			status.Addresses = append(status.Addresses, addr.String())
+		}
+	}
+	return status
+}
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"context"
+	"dforum-app/configuration"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-tcp-transport"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestConnectThroughRelay(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	relay := newRelayTestHost(t, libp2p.ForceReachabilityPublic(), libp2p.ChainOptions(relayOptions(configuration.RelayModeService, nil, false)...))
+	relayInfo := peer.AddrInfo{ID: relay.ID(), Addrs: relay.Addrs()}
+
+	natted := newRelayTestHost(t, libp2p.ForceReachabilityPrivate(), libp2p.ChainOptions(relayOptions(configuration.RelayModeClient, []peer.AddrInfo{relayInfo}, false)...))
+	tracker, err := startReachabilityTracker(natted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+	// The client reserves a slot on the relay once it knows it is behind a NAT
+	deadline := time.Now().Add(10 * time.Second)
+	for natted.Network().Connectedness(relay.ID()) != network.Connected || tracker.Get() != network.ReachabilityPrivate {
+		if time.Now().After(deadline) {
+			t.Fatal("client did not connect to the relay")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	dialer := newRelayTestHost(t) // The relay transport is enabled by default
+	circuit, _ := ma.NewMultiaddr("/p2p/" + relay.ID().String() + "/p2p-circuit")
+	addrs := []ma.Multiaddr{}
+	for _, addr := range relay.Addrs() {
+		addrs = append(addrs, addr.Encapsulate(circuit))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for {
+		err = dialer.Connect(ctx, peer.AddrInfo{ID: natted.ID(), Addrs: addrs})
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal("could not connect through the relay:", err)
+		}
+		time.Sleep(200 * time.Millisecond) // Reservation may not be made yet
+	}
+	conn := dialer.Network().ConnsToPeer(natted.ID())[0]
+	if _, err := conn.RemoteMultiaddr().ValueForProtocol(ma.P_CIRCUIT); err != nil {
+		t.Fatal("connection should go through the relay:", conn.RemoteMultiaddr())
+	}
+}
+
+func TestNetworkStatus(t *testing.T) {
+	h := newRelayTestHost(t)
+	status := getNetworkStatus(h, network.ReachabilityPrivate)
+	if status.PeerID != h.ID().String() || status.Reachability != "Private" {
+		t.Fatal("unexpected status:", status)
+	}
+	if len(status.Addresses) == 0 || len(status.RelayAddresses) != 0 {
+		t.Fatal("unexpected addresses:", status.Addresses, status.RelayAddresses)
+	}
+}
+
+func newRelayTestHost(t *testing.T, options ...libp2p.Option) host.Host {
+	options = append(options,
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.Transport(tcp.NewTCPTransport),
+	)
+	h, err := libp2p.New(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
@@ -5,7 +5,6 @@ import (
 	"dforum-app/configuration"
 	"dforum-app/network/communication"
 	"dforum-app/storage"
-	"math/rand"
 	"sync"
 
 	"github.com/libp2p/go-libp2p-core/crypto"
@@ -15,16 +14,22 @@ import (
 	"github.com/libp2p/go-libp2p-core/protocol"
 	disc "github.com/libp2p/go-libp2p-discovery"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	"github.com/multiformats/go-multiaddr"
 )
 
 type NetworkModule struct {
 	communicationMgr *communication.CommunicationManager
+	syncScheduler    *SyncScheduler
+	mdnsService      mdns.Service
+	reachability     *reachabilityTracker
+	addressBook      *AddressBook
 }
 
 func NewNetworkModule(sM *storage.StorageModule) *NetworkModule {
 	return &NetworkModule{
 		communicationMgr: communication.NewCommunicationManager(sM),
+		addressBook:      NewAddressBook(sM),
 	}
 }
 
@@ -38,51 +43,83 @@ func (n *NetworkModule) CreateAndStartHost() {
 		panic(err)
 	}
 
-	host, ctx, dht := CreateDefaultNode(configuration.GetNetworkPort(), priv)
+	psk, err := GetNetworkKey()
+	if err != nil {
+		panic(err)
+	}
+	host, ctx, dht := CreateDefaultNode(configuration.GetNetworkPort(), priv, psk, n.communicationMgr.GetConnectionGater())
 	n.communicationMgr.SetHost(host, ctx)
+	n.addressBook.Start(host)
+	n.reachability, err = startReachabilityTracker(host)
+	if err != nil {
+		configuration.Logger.Error("could not track reachability:", err.Error())
+	}
 
 	host.SetStreamHandler(n.communicationMgr.GetProtocolID(), n.communicationMgr.GetMessageHandler())
+	if configuration.GetPropagationMode() == configuration.PropagationGossipSub {
+		if err := n.communicationMgr.EnableGossipSub(); err != nil {
+			configuration.Logger.Error("could not enable gossipsub, falling back to direct propagation:", err.Error())
+		}
+	}
 
-	bootstrap(host, ctx)
-	setPeerRouting(host, ctx, dht, n.communicationMgr.GetProtocolID())
+	// Sync with peers as they connect and periodically afterwards
+	interval, fanout, jitter := configuration.GetSyncSchedule()
+	n.syncScheduler = NewSyncScheduler(host, n.communicationMgr, interval, fanout, jitter)
+	n.syncScheduler.Start()
 
-	// Sync with random peer, try max 10 peers
-	if len(host.Network().Peers()) > 0 {
-		for i := 0; i < 10; i++ {
-			randIdx := rand.Intn(len(host.Network().Peers()))
-			randPeer := host.Network().Peers()[randIdx]
-			if _, err := host.Peerstore().SupportsProtocols(randPeer, string(n.communicationMgr.GetProtocolID())); err == nil {
-				n.communicationMgr.Sync(randPeer)
-				break
-			}
+	if configuration.IsMdnsEnabled() {
+		n.mdnsService, err = startMdnsDiscovery(ctx, host, n.syncScheduler)
+		if err != nil {
+			configuration.Logger.Error("could not start local peer discovery:", err.Error())
 		}
 	}
+
+	bootstrap(host, ctx, psk != nil, n.addressBook)
+	setPeerRouting(host, ctx, dht, n.communicationMgr.GetProtocolID())
 }
 
-func bootstrap(h host.Host, ctx context.Context) {
+// Max number of peers from the address book dialed on startup
+const maxReconnectCandidates = 32
+
+func bootstrap(h host.Host, ctx context.Context, private bool, addressBook *AddressBook) {
 	// Boostrap onto the network
+	// Peers saved in the config by previous versions are still dialed
 	targetPeers := append(configuration.GetNetworkSeeds(), configuration.GetNetworkPeers()...)
+	if private {
+		// Public seeds cannot be part of a private forum
+		targetPeers = append(configuration.GetPrivateNetworkSeeds(), configuration.GetNetworkPeers()...)
+		targetPeers = withoutPublicBootstrapPeers(targetPeers)
+	}
+	targets := make(map[peer.ID]peer.AddrInfo)
+	for _, address := range targetPeers {
+		seedInfo, err := peer.AddrInfoFromString(address)
+		if err != nil {
+			configuration.Logger.Errorf("connecting to bootstrap: %s", err)
+			continue
+		}
+		targets[seedInfo.ID] = *seedInfo
+	}
+	// Reconnect to peers known from previous sessions
+	for _, info := range addressBook.Candidates(maxReconnectCandidates) {
+		if seedInfo, ok := targets[info.ID]; ok {
+			info.Addrs = append(info.Addrs, seedInfo.Addrs...)
+		}
+		targets[info.ID] = info
+	}
 
 	wg := new(sync.WaitGroup)
-	wg.Add(len(targetPeers))
-	for _, address := range targetPeers {
-		go func(address string) {
+	wg.Add(len(targets))
+	for _, info := range targets {
+		go func(info peer.AddrInfo) {
 			defer wg.Done()
-			seedAddr, err := multiaddr.NewMultiaddr(address)
-			if err != nil {
-				configuration.Logger.Errorf("connecting to bootstrap: %s", err)
-			}
-			seedInfo, err := peer.AddrInfoFromP2pAddr(seedAddr)
-			if err != nil {
-				configuration.Logger.Errorf("connecting to bootstrap: %s", err)
-			}
-			err = h.Connect(ctx, *seedInfo)
+			err := h.Connect(ctx, info)
+			addressBook.RecordDial(info.ID, err == nil)
 			if err != nil {
 				configuration.Logger.Errorf("connecting to bootstrap: %s", err)
 			} else {
-				configuration.Logger.Info("connected to", seedInfo.ID.ShortString())
+				configuration.Logger.Info("connected to", info.ID.ShortString())
 			}
-		}(address)
+		}(info)
 	}
 	go func() {
 		wg.Wait()
@@ -93,6 +130,24 @@ func bootstrap(h host.Host, ctx context.Context) {
 	}()
 }
 
+// Remove the public libp2p bootstrap peers from a list of addresses
+func withoutPublicBootstrapPeers(addresses []string) []string {
+	publicPeers := make(map[peer.ID]bool)
+	for _, info := range dht.GetDefaultBootstrapPeerAddrInfos() {
+		publicPeers[info.ID] = true
+	}
+	filtered := []string{}
+	for _, address := range addresses {
+		info, err := peer.AddrInfoFromString(address)
+		if err == nil && publicPeers[info.ID] {
+			configuration.Logger.Error("ignoring public bootstrap peer in private mode:", address)
+			continue
+		}
+		filtered = append(filtered, address)
+	}
+	return filtered
+}
+
 func (n *NetworkModule) GetAddress() multiaddr.Multiaddr {
 	h, _ := n.communicationMgr.GetHost()
 	peerInfo := peer.AddrInfo{
@@ -103,7 +158,78 @@ func (n *NetworkModule) GetAddress() multiaddr.Multiaddr {
 	return addrs[0]
 }
 
+// List nodes announced by peers that are still waiting to be fetched
+func (n *NetworkModule) GetWantList() []communication.WantInfo {
+	return n.communicationMgr.GetWantList()
+}
+
+// Reputation of peers, including banned ones, for diagnostics
+func (n *NetworkModule) GetPeerScores() []communication.PeerScoreInfo {
+	return n.communicationMgr.GetPeerScores()
+}
+
+// Reachability, addresses and relay setup of the host
+func (n *NetworkModule) GetStatus() NetworkStatus {
+	h, _ := n.communicationMgr.GetHost()
+	reachability := network.ReachabilityUnknown
+	if n.reachability != nil {
+		reachability = n.reachability.Get()
+	}
+	return getNetworkStatus(h, reachability)
+}
+
+// Connected peer, with the score of its behaviour
+type PeerInfo struct {
+	ID    string
+	Addrs []string
+	Score float64
+}
+
+func (n *NetworkModule) GetConnectedPeers() []PeerInfo {
+	h, _ := n.communicationMgr.GetHost()
+	scores := make(map[string]float64)
+	for _, s := range n.communicationMgr.GetPeerScores() {
+		scores[s.Peer] = s.Score
+	}
+	peers := []PeerInfo{}
+	for _, p := range h.Network().Peers() {
+		info := PeerInfo{ID: p.String(), Addrs: []string{}, Score: scores[p.String()]}
+		for _, c := range h.Network().ConnsToPeer(p) {
+			info.Addrs = append(info.Addrs, c.RemoteMultiaddr().String())
+		}
+		peers = append(peers, info)
+	}
+	return peers
+}
+
+// Sync with every connected peer speaking the message protocol, returns the number of peers that responded
+func (n *NetworkModule) SyncNow() int {
+	h, _ := n.communicationMgr.GetHost()
+	synced := 0
+	for _, p := range h.Network().Peers() {
+		if communication.SupportsMessageProtocol(h, p) && n.communicationMgr.Sync(p) {
+			synced++
+		}
+	}
+	return synced
+}
+
+// Peers known from current and previous sessions
+func (n *NetworkModule) GetAddressBook() map[string]storage.PeerRecord {
+	return n.addressBook.GetRecords()
+}
+
 func (n *NetworkModule) TearDown() {
+	n.addressBook.Stop()
+	if n.reachability != nil {
+		n.reachability.Close()
+	}
+	if n.mdnsService != nil {
+		n.mdnsService.Close()
+	}
+	if n.syncScheduler != nil {
+		n.syncScheduler.Stop()
+	}
 	n.communicationMgr.TearDown()
 }
 
@@ -3,26 +3,25 @@ package network
 import (
 	"context"
 	"dforum-app/configuration"
-	"fmt"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
 	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	ifconnmgr "github.com/libp2p/go-libp2p-core/connmgr"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/pnet"
 	"github.com/libp2p/go-libp2p-core/routing"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	mplex "github.com/libp2p/go-libp2p-mplex"
-	libp2ptls "github.com/libp2p/go-libp2p-tls"
-	"github.com/libp2p/go-tcp-transport"
 )
 
 /*
 	Node Factories
 */
 
-func CreateDefaultNode(port int, priv crypto.PrivKey) (host.Host, context.Context, *dht.IpfsDHT) {
+func CreateDefaultNode(port int, priv crypto.PrivKey, psk pnet.PSK, gater ifconnmgr.ConnectionGater) (host.Host, context.Context, *dht.IpfsDHT) {
 	// Inspired by https://github.com/libp2p/go-libp2p/blob/master/examples/libp2p-host/host.go
 	// and https://github.com/libp2p/go-libp2p/blob/master/examples/ipfs-camp-2019
 	ctx := context.Background()
@@ -30,14 +29,11 @@ func CreateDefaultNode(port int, priv crypto.PrivKey) (host.Host, context.Contex
 	// Create Node
 	identity := libp2p.Identity(priv)
 
-	listeningAddresses := libp2p.ListenAddrStrings(
-		fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port), // regular tcp connections
-		fmt.Sprintf("/ip6/::/tcp/%d", port),      // include IPv6 support
-	)
-	transport := libp2p.Transport(tcp.NewTCPTransport)
+	ports := transportPorts{tcp: port, websocket: configuration.GetWebSocketPort()}
+	transports := transportOptions(configuration.GetTransports(), ports, psk)
 
 	muxers := libp2p.Muxer("/mplex/6.7.0", mplex.DefaultTransport)
-	security := libp2p.Security(libp2ptls.ID, libp2ptls.New)
+	security := securityOptions(configuration.GetSecurityProtocols())
 
 	low, high := configuration.GetConnectionLimits()
 	cm, _ := connmgr.NewConnManager(
@@ -56,17 +52,26 @@ func CreateDefaultNode(port int, priv crypto.PrivKey) (host.Host, context.Contex
 	}
 	routing := libp2p.Routing(dhtRouting)
 
-	h, err := libp2p.New(
+	options := []libp2p.Option{
 		identity,
-		listeningAddresses,
-		transport,
+		transports,
 		muxers,
 		security,
 		connectionManager,
+		// Refuse connections from banned peers
+		libp2p.ConnectionGater(gater),
 		// Attempt to open ports using uPNP for NATed hosts.
 		libp2p.NATPortMap(),
 		routing,
-	)
+	}
+	// Reach peers behind NATs, and be reached from behind one, through relays and hole punching
+	options = append(options, relayOptions(configuration.GetRelayMode(), getStaticRelays(psk != nil), configuration.IsHolePunchingEnabled())...)
+	// Only hosts sharing the key of a private forum can connect
+	if psk != nil {
+		options = append(options, libp2p.PrivateNetwork(psk))
+	}
+
+	h, err := libp2p.New(options...)
 	if err != nil {
 		panic(err)
 	}
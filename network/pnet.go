@@ -0,0 +1,66 @@
+package network
+
+import (
+	"bytes"
+	"crypto/rand"
+	"dforum-app/configuration"
+	"encoding/hex"
+	"errors"
+	"os"
+
+	"github.com/libp2p/go-libp2p-core/pnet"
+)
+
+// Header of the swarm.key format used by libp2p tools to share network keys
+const networkKeyHeader = "/key/swarm/psk/1.0.0/\n/base16/\n"
+
+const networkKeyLength = 32
+
+// Get the pre-shared key of the private forum configured, nil for the public network.
+// Hosts with different keys cannot complete a handshake.
+func GetNetworkKey() (pnet.PSK, error) {
+	encoded := configuration.GetNetworkKey()
+	if encoded == "" {
+		return nil, nil
+	}
+	psk, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(psk) != networkKeyLength {
+		return nil, errors.New("invalid network key length")
+	}
+	return psk, nil
+}
+
+// Generate a new private forum key, save it in the configuration
+// and export it to a swarm.key file to be shared with the forum members.
+func ExportNewNetworkKey(path string) error {
+	psk := make([]byte, networkKeyLength)
+	if _, err := rand.Read(psk); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, encodeNetworkKey(psk), 0600); err != nil {
+		return err
+	}
+	configuration.SetNetworkKey(hex.EncodeToString(psk))
+	return nil
+}
+
+// Join a private forum using a swarm.key file shared by one of its members
+func ImportNetworkKey(path string) error {
+	keyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	psk, err := pnet.DecodeV1PSK(bytes.NewReader(keyBytes))
+	if err != nil {
+		return err
+	}
+	configuration.SetNetworkKey(hex.EncodeToString(psk))
+	return nil
+}
+
+func encodeNetworkKey(psk pnet.PSK) []byte {
+	return []byte(networkKeyHeader + hex.EncodeToString(psk) + "\n")
+}
@@ -0,0 +1,66 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/pnet"
+	"github.com/libp2p/go-tcp-transport"
+)
+
+func TestNetworkKeyEncoding(t *testing.T) {
+	psk := newTestKey()
+	decoded, err := pnet.DecodeV1PSK(bytes.NewReader(encodeNetworkKey(psk)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(psk, decoded) {
+		t.Fatal("decoded key does not match the exported key")
+	}
+}
+
+func TestPrivateNetworkIsolation(t *testing.T) {
+	key := newTestKey()
+	h1 := newPrivateHost(t, key)
+	h2 := newPrivateHost(t, key)
+	outsider := newPrivateHost(t, newTestKey())
+	public := newPrivateHost(t, nil)
+
+	ctx := context.Background()
+	if err := h1.Connect(ctx, peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}); err != nil {
+		t.Fatal("hosts sharing a key should connect:", err)
+	}
+	if err := h1.Connect(ctx, peer.AddrInfo{ID: outsider.ID(), Addrs: outsider.Addrs()}); err == nil {
+		t.Fatal("hosts with different keys should not connect")
+	}
+	if err := h1.Connect(ctx, peer.AddrInfo{ID: public.ID(), Addrs: public.Addrs()}); err == nil {
+		t.Fatal("private hosts should not connect to public hosts")
+	}
+}
+
+func newTestKey() pnet.PSK {
+	psk := make([]byte, networkKeyLength)
+	rand.Read(psk)
+	return psk
+}
+
+func newPrivateHost(t *testing.T, psk pnet.PSK) host.Host {
+	options := []libp2p.Option{
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.Transport(tcp.NewTCPTransport),
+	}
+	if psk != nil {
+		options = append(options, libp2p.PrivateNetwork(psk))
+	}
+	h, err := libp2p.New(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
@@ -0,0 +1,180 @@
+package network
+
+import (
+	"dforum-app/configuration"
+	"dforum-app/network/communication"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Min delay between two syncs with the same peer
+const minPeerSyncGap = 30 * time.Second
+
+type peerSyncStats struct {
+	successes int
+	failures  int
+	lastSync  time.Time
+}
+
+// The sync scheduler periodically syncs with a few connected peers to catch up
+// on nodes missed while offline or dropped by the network (anti-entropy).
+// Peers that answered previous syncs are favoured, new connections are synced as soon as they
+// are identified. Only peers speaking the message protocol are synced with.
+type SyncScheduler struct {
+	sync.Mutex
+	host             host.Host
+	communicationMgr *communication.CommunicationManager
+	interval         time.Duration
+	fanout           int
+	jitter           time.Duration
+	stats            map[peer.ID]*peerSyncStats
+	sub              event.Subscription
+	stop             chan struct{}
+	stopOnce         sync.Once
+}
+
+func NewSyncScheduler(h host.Host, cm *communication.CommunicationManager, interval time.Duration, fanout int, jitter time.Duration) *SyncScheduler {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	if fanout <= 0 {
+		fanout = 1
+	}
+	s := &SyncScheduler{
+		host:             h,
+		communicationMgr: cm,
+		interval:         interval,
+		fanout:           fanout,
+		jitter:           jitter,
+		stats:            make(map[peer.ID]*peerSyncStats),
+		stop:             make(chan struct{}),
+	}
+	return s
+}
+
+// Start syncing periodically and on every new connection, once the peer identified its protocols
+func (s *SyncScheduler) Start() {
+	sub, err := s.host.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	if err != nil {
+		configuration.Logger.Error("could not subscribe to peer identification:", err.Error())
+	} else {
+		s.sub = sub
+		go func() {
+			for e := range sub.Out() {
+				go s.SyncPeer(e.(event.EvtPeerIdentificationCompleted).Peer)
+			}
+		}()
+	}
+	go s.run()
+}
+
+func (s *SyncScheduler) Stop() {
+	s.stopOnce.Do(func() {
+		if s.sub != nil {
+			s.sub.Close()
+		}
+		close(s.stop)
+	})
+}
+
+func (s *SyncScheduler) run() {
+	for {
+		s.syncRound()
+		wait := s.interval
+		if s.jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(s.jitter)))
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Sync with a selection of connected forum peers
+func (s *SyncScheduler) syncRound() {
+	candidates := []peer.ID{}
+	for _, p := range s.host.Network().Peers() {
+		if communication.SupportsMessageProtocol(s.host, p) {
+			candidates = append(candidates, p)
+		}
+	}
+	peers := s.pickPeers(candidates)
+	configuration.Logger.Infof("periodic sync with %d peers", len(peers))
+	for _, p := range peers {
+		s.SyncPeer(p)
+	}
+}
+
+// Sync with a peer unless it was synced recently or does not speak the message protocol
+func (s *SyncScheduler) SyncPeer(p peer.ID) {
+	if !communication.SupportsMessageProtocol(s.host, p) {
+		return
+	}
+	s.Lock()
+	stats := s.getStats(p)
+	if time.Since(stats.lastSync) < minPeerSyncGap {
+		s.Unlock()
+		return
+	}
+	stats.lastSync = time.Now()
+	s.Unlock()
+
+	ok := s.communicationMgr.Sync(p)
+
+	s.Lock()
+	defer s.Unlock()
+	if ok {
+		stats.successes++
+	} else {
+		stats.failures++
+	}
+}
+
+// Weighted random selection of peers without replacement.
+// A peer's weight grows with successful syncs and shrinks with failed ones.
+func (s *SyncScheduler) pickPeers(candidates []peer.ID) []peer.ID {
+	s.Lock()
+	defer s.Unlock()
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, p := range candidates {
+		stats := s.getStats(p)
+		weights[i] = float64(stats.successes+1) / float64(stats.failures+1)
+		total += weights[i]
+	}
+	picked := []peer.ID{}
+	for len(picked) < s.fanout && len(picked) < len(candidates) {
+		r := rand.Float64() * total
+		chosen := -1
+		for i, w := range weights {
+			if w == 0 { // Already picked
+				continue
+			}
+			chosen = i
+			r -= w
+			if r <= 0 {
+				break
+			}
+		}
+		picked = append(picked, candidates[chosen])
+		total -= weights[chosen]
+		weights[chosen] = 0
+	}
+	return picked
+}
+
+func (s *SyncScheduler) getStats(p peer.ID) *peerSyncStats {
+	stats, ok := s.stats[p]
+	if !ok {
+		stats = &peerSyncStats{}
+		s.stats[p] = stats
+	}
+	return stats
+}
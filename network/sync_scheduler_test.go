@@ -0,0 +1,59 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+)
+
+func TestPickPeersFanout(t *testing.T) {
+	s := NewSyncScheduler(nil, nil, time.Minute, 3, 0)
+	candidates := []peer.ID{}
+	for i := 0; i < 5; i++ {
+		p, _ := test.RandPeerID()
+		candidates = append(candidates, p)
+	}
+	picked := s.pickPeers(candidates)
+	if len(picked) != 3 {
+		t.Fatalf("expected 3 peers, got %d", len(picked))
+	}
+	seen := map[peer.ID]bool{}
+	for _, p := range picked {
+		if seen[p] {
+			t.Fatal("peers should be picked without replacement")
+		}
+		seen[p] = true
+	}
+	if len(s.pickPeers(candidates[:2])) != 2 {
+		t.Fatal("fanout should be limited by the number of peers")
+	}
+}
+
+func TestPickPeersFavoursReliablePeers(t *testing.T) {
+	s := NewSyncScheduler(nil, nil, time.Minute, 1, 0)
+	good, _ := test.RandPeerID()
+	bad, _ := test.RandPeerID()
+	s.getStats(good).successes = 20
+	s.getStats(bad).failures = 20
+
+	goodPicks := 0
+	for i := 0; i < 1000; i++ {
+		if s.pickPeers([]peer.ID{good, bad})[0] == good {
+			goodPicks++
+		}
+	}
+	if goodPicks < 900 {
+		t.Fatalf("expected the reliable peer to be favoured, picked %d/1000 times", goodPicks)
+	}
+}
+
+func TestSyncOnlyForumPeers(t *testing.T) {
+	s := NewSyncScheduler(newAddressBookHost(t), nil, time.Minute, 1, 0)
+	dhtOnly, _ := test.RandPeerID()
+	s.SyncPeer(dhtOnly)
+	if _, ok := s.stats[dhtOnly]; ok {
+		t.Fatal("peers without the message protocol should not be synced with")
+	}
+}
@@ -0,0 +1,75 @@
+package network
+
+import (
+	"dforum-app/configuration"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/pnet"
+	noise "github.com/libp2p/go-libp2p-noise"
+	quic "github.com/libp2p/go-libp2p-quic-transport"
+	libp2ptls "github.com/libp2p/go-libp2p-tls"
+	"github.com/libp2p/go-tcp-transport"
+	ws "github.com/libp2p/go-ws-transport"
+)
+
+// Ports used by the transports listening on the same host.
+// QUIC runs over UDP so it shares its port number with TCP.
+type transportPorts struct {
+	tcp       int
+	websocket int
+}
+
+// Transports and their listening addresses, several can be used at the same time.
+// QUIC does not support private networks and is skipped when a network key is set.
+func transportOptions(transports []string, ports transportPorts, psk pnet.PSK) libp2p.Option {
+	options := []libp2p.Option{}
+	addresses := []string{}
+	for _, t := range transports {
+		switch t {
+		case configuration.TransportTCP:
+			options = append(options, libp2p.Transport(tcp.NewTCPTransport))
+			addresses = append(addresses,
+				fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", ports.tcp), // regular tcp connections
+				fmt.Sprintf("/ip6/::/tcp/%d", ports.tcp),      // include IPv6 support
+			)
+		case configuration.TransportQUIC:
+			if psk != nil {
+				configuration.Logger.Info("QUIC does not support private forums, transport disabled")
+				continue
+			}
+			options = append(options, libp2p.Transport(quic.NewTransport))
+			addresses = append(addresses,
+				fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic", ports.tcp),
+				fmt.Sprintf("/ip6/::/udp/%d/quic", ports.tcp),
+			)
+		case configuration.TransportWebSocket:
+			options = append(options, libp2p.Transport(ws.New))
+			addresses = append(addresses,
+				fmt.Sprintf("/ip4/0.0.0.0/tcp/%d/ws", ports.websocket),
+				fmt.Sprintf("/ip6/::/tcp/%d/ws", ports.websocket),
+			)
+		}
+	}
+	if len(options) == 0 { // Always listen on at least one transport
+		return transportOptions([]string{configuration.TransportTCP}, ports, psk)
+	}
+	return libp2p.ChainOptions(append(options, libp2p.ListenAddrStrings(addresses...))...)
+}
+
+// Security protocols offered to peers, the first one being preferred
+func securityOptions(protocols []string) libp2p.Option {
+	options := []libp2p.Option{}
+	for _, p := range protocols {
+		switch p {
+		case configuration.SecurityTLS:
+			options = append(options, libp2p.Security(libp2ptls.ID, libp2ptls.New))
+		case configuration.SecurityNoise:
+			options = append(options, libp2p.Security(noise.ID, noise.New))
+		}
+	}
+	if len(options) == 0 {
+		return libp2p.Security(libp2ptls.ID, libp2ptls.New)
+	}
+	return libp2p.ChainOptions(options...)
+}
@@ -0,0 +1,124 @@
+package network
+
+import (
+	"context"
+	"dforum-app/configuration"
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mplex "github.com/libp2p/go-libp2p-mplex"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestTransportsOnLoopback(t *testing.T) {
+	tcp, ws := configuration.TransportTCP, configuration.TransportWebSocket
+	tls, noise := configuration.SecurityTLS, configuration.SecurityNoise
+	cases := []struct {
+		name       string
+		transports []string
+		security   []string
+		protocol   int // Transport the dialer has to use
+	}{
+		{"tcp-tls", []string{tcp}, []string{tls}, ma.P_TCP},
+		{"tcp-noise", []string{tcp}, []string{noise}, ma.P_TCP},
+		{"ws-tls", []string{ws}, []string{tls}, ma.P_WS},
+		{"ws-noise", []string{ws}, []string{noise}, ma.P_WS},
+		{"tcp+ws over ws", []string{tcp, ws}, []string{tls, noise}, ma.P_WS},
+		{"tcp+ws over tcp", []string{tcp, ws}, []string{noise, tls}, ma.P_TCP},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h1 := newTransportHost(t, c.transports, c.security)
+			h2 := newTransportHost(t, c.transports, c.security)
+			connectOver(t, h1, h2, c.protocol)
+		})
+	}
+}
+
+func TestSecurityNegotiation(t *testing.T) {
+	// Hosts agree on a protocol they both support
+	transports := []string{configuration.TransportTCP}
+	h1 := newTransportHost(t, transports, []string{configuration.SecurityTLS, configuration.SecurityNoise})
+	h2 := newTransportHost(t, transports, []string{configuration.SecurityNoise})
+	connectOver(t, h1, h2, ma.P_TCP)
+}
+
+func TestQuicOnLoopback(t *testing.T) {
+	transports := []string{configuration.TransportQUIC, configuration.TransportTCP}
+	options := []libp2p.Option{
+		transportOptions(transports, transportPorts{}, nil),
+		securityOptions([]string{configuration.SecurityTLS}),
+	}
+	h1, err := libp2p.New(options...)
+	if err != nil {
+		t.Skip("QUIC unavailable:", err)
+	}
+	defer h1.Close()
+	h2 := newTransportHost(t, transports, []string{configuration.SecurityTLS})
+	connectOver(t, h1, h2, ma.P_QUIC)
+}
+
+func TestQuicDisabledOnPrivateNetworks(t *testing.T) {
+	h := newPrivateTransportHost(t, []string{configuration.TransportQUIC, configuration.TransportTCP}, newTestKey())
+	for _, addr := range h.Addrs() {
+		if _, err := addr.ValueForProtocol(ma.P_QUIC); err == nil {
+			t.Fatal("private host should not listen on QUIC:", addr)
+		}
+	}
+}
+
+func newTransportHost(t *testing.T, transports []string, security []string) host.Host {
+	h, err := libp2p.New(
+		transportOptions(transports, transportPorts{}, nil),
+		securityOptions(security),
+		libp2p.Muxer("/mplex/6.7.0", mplex.DefaultTransport),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func newPrivateTransportHost(t *testing.T, transports []string, psk []byte) host.Host {
+	h, err := libp2p.New(
+		transportOptions(transports, transportPorts{}, psk),
+		libp2p.PrivateNetwork(psk),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// Connect two hosts using only the addresses of a given transport
+func connectOver(t *testing.T, h1 host.Host, h2 host.Host, protocol int) {
+	addrs := []ma.Multiaddr{}
+	for _, addr := range h2.Addrs() {
+		if _, err := addr.ValueForProtocol(protocol); err != nil {
+			continue
+		}
+		if protocol == ma.P_TCP {
+			if _, err := addr.ValueForProtocol(ma.P_WS); err == nil {
+				continue
+			}
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		t.Fatal("host is not listening on the expected transport:", h2.Addrs())
+	}
+	if err := h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: addrs}); err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	conns := h1.Network().ConnsToPeer(h2.ID())
+	if len(conns) == 0 {
+		t.Fatal("no connection to peer")
+	}
+	if _, err := conns[0].RemoteMultiaddr().ValueForProtocol(protocol); err != nil {
+		t.Fatal("connection does not use the expected transport:", conns[0].RemoteMultiaddr())
+	}
+}
@@ -0,0 +1,202 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+/*
+	Content of nodes is written in a subset of Markdown:
+	paragraphs, headings (#, ## and ###), fenced code blocks, quotes, ordered and unordered lists,
+	*emphasis*, **strong**, `code`, [links](https://...) and ![images](https://...).
+	The HTML is built from escaped text only, so that raw HTML in content is always shown as text.
+*/
+
+type MarkdownOptions struct {
+	// Show images from remote hosts, which reveals the reader to them, instead of links to them
+	RemoteImages bool
+}
+
+const (
+	maxQuoteDepth  = 8
+	maxInlineDepth = 16
+)
+
+var (
+	headingLine     = regexp.MustCompile(`^(#{1,3})\s+(.*)$`)
+	unorderedItem   = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	orderedItem     = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+(.*)$`)
+	allowedLinkURL  = regexp.MustCompile(`^(?i)(https?://|mailto:)[^\s]+$`)
+	allowedImageURL = regexp.MustCompile(`^(?i)https://[^\s]+$`)
+)
+
+// Render Markdown content to HTML that is safe to insert in a page
+func Markdown(content string, opts MarkdownOptions) string {
+	b := &strings.Builder{}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	renderBlocks(b, lines, opts, 0)
+	return b.String()
+}
+
+func renderBlocks(b *strings.Builder, lines []string, opts MarkdownOptions, quoteDepth int) {
+	paragraph := []string{}
+	endParagraph := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		b.WriteString("<p>")
+		for i, line := range paragraph {
+			if i > 0 {
+				b.WriteString("<br>\n")
+			}
+			renderInline(b, strings.TrimSpace(line), opts, 0)
+		}
+		b.WriteString("</p>\n")
+		paragraph = paragraph[:0]
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			endParagraph()
+		case strings.HasPrefix(trimmed, "```"):
+			endParagraph()
+			code := []string{}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case headingLine.MatchString(trimmed):
+			endParagraph()
+			m := headingLine.FindStringSubmatch(trimmed)
+			// Headings start at h3, below the titles of nodes
+			tag := []string{"h3", "h4", "h5"}[len(m[1])-1]
+			b.WriteString("<" + tag + ">")
+			renderInline(b, m[2], opts, 0)
+			b.WriteString("</" + tag + ">\n")
+		case strings.HasPrefix(trimmed, ">") && quoteDepth < maxQuoteDepth:
+			endParagraph()
+			quoted := []string{}
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quoted = append(quoted, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"), " "))
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted, opts, quoteDepth+1)
+			b.WriteString("</blockquote>\n")
+		case unorderedItem.MatchString(line) || orderedItem.MatchString(line):
+			endParagraph()
+			item, tag := unorderedItem, "ul"
+			if !unorderedItem.MatchString(line) {
+				item, tag = orderedItem, "ol"
+			}
+			b.WriteString("<" + tag + ">\n")
+			for ; i < len(lines) && item.MatchString(lines[i]); i++ {
+				b.WriteString("<li>")
+				renderInline(b, item.FindStringSubmatch(lines[i])[1], opts, 0)
+				b.WriteString("</li>\n")
+			}
+			i--
+			b.WriteString("</" + tag + ">\n")
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	endParagraph()
+}
+
+func renderInline(b *strings.Builder, text string, opts MarkdownOptions, depth int) {
+	if depth >= maxInlineDepth {
+		b.WriteString(html.EscapeString(text))
+		return
+	}
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune("\\`*_[]()#+-.!>", rune(rest[1])):
+			b.WriteString(html.EscapeString(rest[1:2]))
+			i += 2
+			continue
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				b.WriteString("<code>" + html.EscapeString(rest[1:end+1]) + "</code>")
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(rest, "!["):
+			if label, url, n, ok := parseLink(rest[1:]); ok {
+				renderImage(b, label, url, opts)
+				i += n + 1
+				continue
+			}
+		case rest[0] == '[':
+			if label, url, n, ok := parseLink(rest); ok {
+				renderLink(b, label, url, opts, depth)
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "**"):
+			if end := strings.Index(rest[2:], "**"); end > 0 {
+				b.WriteString("<strong>")
+				renderInline(b, rest[2:end+2], opts, depth+1)
+				b.WriteString("</strong>")
+				i += end + 4
+				continue
+			}
+		case (rest[0] == '*' || rest[0] == '_') && !(rest[0] == '_' && i > 0 && isWordByte(text[i-1])):
+			if end := strings.IndexByte(rest[1:], rest[0]); end > 0 && rest[1] != ' ' {
+				b.WriteString("<em>")
+				renderInline(b, rest[1:end+1], opts, depth+1)
+				b.WriteString("</em>")
+				i += end + 2
+				continue
+			}
+		}
+		b.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+}
+
+// Parse [label](url) at the start of text, returning its length
+func parseLink(text string) (string, string, int, bool) {
+	closing := strings.IndexByte(text, ']')
+	if closing < 0 || !strings.HasPrefix(text[closing+1:], "(") {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(text[closing+2:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	return text[1:closing], strings.TrimSpace(text[closing+2 : closing+2+end]), closing + 3 + end, true
+}
+
+// Links open outside of the application and are marked as external
+func renderLink(b *strings.Builder, label string, url string, opts MarkdownOptions, depth int) {
+	if !allowedLinkURL.MatchString(url) {
+		renderInline(b, label, opts, depth+1)
+		return
+	}
+	b.WriteString(`<a href="` + html.EscapeString(url) + `" class="external" target="_blank" rel="nofollow noopener noreferrer">`)
+	renderInline(b, label, opts, depth+1)
+	b.WriteString("</a>")
+}
+
+// Remote images are replaced by links unless allowed
+func renderImage(b *strings.Builder, alt string, url string, opts MarkdownOptions) {
+	switch {
+	case opts.RemoteImages && allowedImageURL.MatchString(url):
+		b.WriteString(`<img src="` + html.EscapeString(url) + `" alt="` + html.EscapeString(alt) + `" referrerpolicy="no-referrer">`)
+	case allowedLinkURL.MatchString(url):
+		b.WriteString(`<a href="` + html.EscapeString(url) + `" class="external" target="_blank" rel="nofollow noopener noreferrer">`)
+		b.WriteString("image: " + html.EscapeString(alt) + "</a>")
+	default:
+		b.WriteString(html.EscapeString(alt))
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,54 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	for content, expected := range map[string]string{
+		"Hello *you* and **all**":              "<p>Hello <em>you</em> and <strong>all</strong></p>\n",
+		"first\nsecond\n\nthird":               "<p>first<br>\nsecond</p>\n<p>third</p>\n",
+		"## Title":                             "<h4>Title</h4>\n",
+		"- one\n- `two`":                       "<ul>\n<li>one</li>\n<li><code>two</code></li>\n</ul>\n",
+		"1. one\n2. two":                       "<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n",
+		"> quoted\n> text":                     "<blockquote>\n<p>quoted<br>\ntext</p>\n</blockquote>\n",
+		"```\n<b>code</b>\n```":                "<pre><code>&lt;b&gt;code&lt;/b&gt;</code></pre>\n",
+		"snake_case_name":                      "<p>snake_case_name</p>\n",
+		`\*not emphasis\*`:                     "<p>*not emphasis*</p>\n",
+		"[site](https://example.org/?a=1&b=2)": `<p><a href="https://example.org/?a=1&amp;b=2" class="external" target="_blank" rel="nofollow noopener noreferrer">site</a></p>` + "\n",
+	} {
+		if html := Markdown(content, MarkdownOptions{}); html != expected {
+			t.Errorf("%q rendered as %q, expected %q", content, html, expected)
+		}
+	}
+}
+
+func TestMarkdownSanitization(t *testing.T) {
+	for _, content := range []string{
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"[click](javascript:alert(1))",
+		"[click](https://example.org\" onclick=\"alert(1))",
+		"![x](https://example.org/a.png\" onerror=\"alert(1))",
+		"![x](data:image/png;base64,AAAA)",
+		"**<iframe src=https://example.org>**",
+	} {
+		html := Markdown(content, MarkdownOptions{RemoteImages: true})
+		for _, forbidden := range []string{"<script", "<img src=x", "<iframe", "javascript:", "data:", "\" onclick", "\" onerror"} {
+			if strings.Contains(html, forbidden) {
+				t.Errorf("%q rendered as unsafe %q", content, html)
+			}
+		}
+	}
+}
+
+func TestMarkdownImages(t *testing.T) {
+	content := "![cat](https://example.org/cat.png)"
+	if html := Markdown(content, MarkdownOptions{}); strings.Contains(html, "<img") || !strings.Contains(html, `class="external"`) {
+		t.Fatal("remote images should be links by default:", html)
+	}
+	if html := Markdown(content, MarkdownOptions{RemoteImages: true}); !strings.Contains(html, `<img src="https://example.org/cat.png" alt="cat"`) {
+		t.Fatal("remote images should be shown when allowed:", html)
+	}
+}
@@ -0,0 +1,200 @@
+// Package render turns discussions into documents that can be shared outside of the forum.
+package render
+
+import (
+	"dforum-app/security"
+	"dforum-app/storage"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+)
+
+// Limits of the threads rendered, far above usual discussions
+const (
+	MaxDepth = 64
+	MaxNodes = 10000
+)
+
+var ErrUnknownFormat = errors.New("unknown document format")
+
+// Node of a rendered document with its replies
+type documentNode struct {
+	ID        string
+	Title     string
+	Content   string
+	HTML      template.HTML // Content rendered from Markdown, remote images left as links
+	Indicator string        // Empty for topics
+	Date      string
+	Replies   []*documentNode
+}
+
+// Render a thread fetched with StorageModule.GetThread, its first node being the root
+func RenderThread(w io.Writer, thread storage.Thread, format Format) error {
+	if len(thread.Nodes) == 0 {
+		return storage.ErrNodeNotFound
+	}
+	root := buildDocument(thread)
+	switch format {
+	case FormatMarkdown:
+		return renderMarkdown(w, root, thread.Truncated)
+	case FormatHTML:
+		return htmlTemplate.Execute(w, struct {
+			Root      *documentNode
+			Truncated bool
+		}{root, thread.Truncated})
+	}
+	return ErrUnknownFormat
+}
+
+// Nest the nodes of a thread, parents coming before their children
+func buildDocument(thread storage.Thread) *documentNode {
+	nodes := make(map[security.HashSignature]*documentNode, len(thread.Nodes))
+	var root *documentNode
+	for _, tn := range thread.Nodes {
+		n := tn.Node
+		doc := &documentNode{
+			ID:      base64.URLEncoding.EncodeToString(n.SecObj.Fingerprint[:]),
+			Title:   n.DatObj.Topic,
+			Content: n.DatObj.Content,
+			HTML:    template.HTML(Markdown(n.DatObj.Content, MarkdownOptions{})),
+			Date:    time.Unix(n.GetTimestamp(), 0).UTC().Format("2006-01-02 15:04 UTC"),
+		}
+		if indicator := n.DatObj.Indicator; indicator >= 0 && indicator <= 10 {
+			doc.Indicator = fmt.Sprintf("%s (%d/10)", IndicatorText(indicator), indicator)
+		}
+		nodes[n.GetFingerprint()] = doc
+		if root == nil {
+			root = doc
+		} else if parent, ok := nodes[n.DatObj.Parent]; ok {
+			parent.Replies = append(parent.Replies, doc)
+		}
+	}
+	return root
+}
+
+func renderMarkdown(w io.Writer, root *documentNode, truncated bool) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# %s\n\n", escapeMarkdown(root.Title))
+	fmt.Fprintf(b, "_%s · `%s`_\n\n", root.Date, root.ID)
+	if root.Content != "" {
+		fmt.Fprintf(b, "%s\n\n", indent(escapeHTML(root.Content), ""))
+	}
+	if len(root.Replies) > 0 {
+		b.WriteString("## Replies\n\n")
+	}
+	for _, reply := range root.Replies {
+		writeMarkdownReply(b, reply, 0)
+	}
+	if truncated {
+		b.WriteString("\n_Some replies were left out._\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Replies are nested list items, their content indented below them
+func writeMarkdownReply(b *strings.Builder, n *documentNode, level int) {
+	prefix := strings.Repeat("  ", level)
+	fmt.Fprintf(b, "%s- **%s**", prefix, escapeMarkdown(n.Title))
+	if n.Indicator != "" {
+		fmt.Fprintf(b, " · %s", n.Indicator)
+	}
+	fmt.Fprintf(b, " · %s · `%s`\n", n.Date, n.ID)
+	if n.Content != "" {
+		fmt.Fprintf(b, "\n%s\n\n", indent(escapeHTML(n.Content), prefix+"  "))
+	}
+	for _, reply := range n.Replies {
+		writeMarkdownReply(b, reply, level+1)
+	}
+}
+
+func indent(text string, prefix string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "#", `\#`,
+	"&", "&amp;", "<", "&lt;", ">", "&gt;",
+)
+
+// Titles are shown as plain text
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(strings.ReplaceAll(text, "\n", " "))
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Content keeps its Markdown formatting but no raw HTML, which Markdown viewers would render
+func escapeHTML(text string) string {
+	return htmlEscaper.Replace(text)
+}
+
+// Agreement with the parent node, with the same wording as the GUI
+func IndicatorText(indicator int8) string {
+	switch {
+	case indicator < 0 || indicator > 10:
+		return "No Opinion"
+	case indicator == 0:
+		return "Completely Disagree"
+	case indicator <= 2:
+		return "Disagree"
+	case indicator <= 4:
+		return "Slightly Disagree"
+	case indicator == 5:
+		return "Neutral"
+	case indicator <= 7:
+		return "Slightly Agree"
+	case indicator <= 9:
+		return "Agree"
+	}
+	return "Completely Agree"
+}
+
+// html/template escapes every value according to its context
+var htmlTemplate = template.Must(template.New("thread").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Root.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: auto; }
+ul { list-style: none; padding-left: 1.5em; border-left: 1px solid #ddd; }
+.meta { color: #666; font-size: 0.85em; }
+</style>
+</head>
+<body>
+<article id="{{.Root.ID}}">
+<h1>{{.Root.Title}}</h1>
+<p class="meta">{{.Root.Date}} · <code>{{.Root.ID}}</code></p>
+<div class="content">{{.Root.HTML}}</div>
+</article>
+{{if .Root.Replies}}<h2>Replies</h2>
+{{template "replies" .Root.Replies}}{{end}}
+{{- if .Truncated}}<p class="meta">Some replies were left out.</p>
+{{end -}}
+</body>
+</html>
+{{define "replies"}}<ul>
+{{range .}}<li id="{{.ID}}">
+<p><strong>{{.Title}}</strong><span class="meta">{{if .Indicator}} · {{.Indicator}}{{end}} · {{.Date}} · <code>{{.ID}}</code></span></p>
+<div class="content">{{.HTML}}</div>
+{{if .Replies}}{{template "replies" .Replies}}{{end}}</li>
+{{end}}</ul>
+{{end}}`))
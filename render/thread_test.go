@@ -0,0 +1,69 @@
+package render
+
+import (
+	"dforum-app/security"
+	"dforum-app/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Nodes without proof of work, fingerprints are derived from the id
+func newTestNode(id byte, parent security.HashSignature, title string, content string, indicator int8) *storage.Node {
+	return &storage.Node{
+		DatObj: storage.DataObject{Parent: parent, Timestamp: time.Date(2022, 3, 17, 10, 0, 0, 0, time.UTC).Unix(),
+			Topic: title, Content: content, Indicator: indicator},
+		SecObj: security.SecurityObject{Fingerprint: security.HashSignature{id}},
+	}
+}
+
+func newTestThread() storage.Thread {
+	topic := newTestNode(1, security.HashSignature{}, "Decision", "Should we <b>ship</b>?", -1)
+	reply := newTestNode(2, topic.GetFingerprint(), "Yes", "Ship it\n<script>alert(1)</script>", 9)
+	nested := newTestNode(3, reply.GetFingerprint(), "No *way*", "Not yet", 1)
+	return storage.Thread{Nodes: []storage.ThreadNode{{Node: topic}, {Node: reply, Depth: 1}, {Node: nested, Depth: 2}}}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	out := &strings.Builder{}
+	if err := RenderThread(out, newTestThread(), FormatMarkdown); err != nil {
+		t.Fatal(err)
+	}
+	document := out.String()
+	for _, expected := range []string{
+		"# Decision\n",
+		"- **Yes** · Agree (9/10) · 2022-03-17 10:00 UTC · `AgAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA==`\n",
+		"  &lt;script&gt;alert(1)&lt;/script&gt;",
+		"  - **No \\*way\\*** · Disagree (1/10)",
+		"    Not yet",
+	} {
+		if !strings.Contains(document, expected) {
+			t.Fatalf("missing %q in:\n%s", expected, document)
+		}
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	out := &strings.Builder{}
+	if err := RenderThread(out, newTestThread(), FormatHTML); err != nil {
+		t.Fatal(err)
+	}
+	document := out.String()
+	if strings.Contains(document, "<script>") || strings.Contains(document, "<b>") {
+		t.Fatal("content should be escaped:", document)
+	}
+	if !strings.Contains(document, "&lt;script&gt;") || strings.Count(document, "<ul>") != 2 {
+		t.Fatal("unexpected document:", document)
+	}
+	if err := RenderThread(out, newTestThread(), "pdf"); err != ErrUnknownFormat {
+		t.Fatal("unknown formats should be refused")
+	}
+}
+
+func TestIndicatorText(t *testing.T) {
+	for indicator, text := range map[int8]string{-1: "No Opinion", 0: "Completely Disagree", 5: "Neutral", 9: "Agree", 10: "Completely Agree"} {
+		if IndicatorText(indicator) != text {
+			t.Fatalf("indicator %d should read %s, got %s", indicator, text, IndicatorText(indicator))
+		}
+	}
+}
@@ -18,7 +18,7 @@ import (
 )
 
 const (
-	maxIterations  int    = 1 << 30 // Max iterations to find a solution
+	maxIterations  int    = 1 << 30 // Max iterations to find a solution, more for difficulties above 26 bits
 	bytesToRead    int    = 8       // Bytes to read for random token
 	bitsPerHexChar int    = 4       // Each hex character takes 4 bits
 	zero           rune   = 48      // ASCII code for number zero
@@ -26,6 +26,9 @@ const (
 	version        string = "DF1"   // Version of hashcash algorithm used
 	shaLength      int    = 64      // Size, in number of hex characters, of hashes compared for PoW
 	stdDifficulty  int    = 24
+	// Lowest and highest difficulties nodes can be created with, from the proof of work levels
+	MinDifficulty int = 16
+	MaxDifficulty int = 28
 )
 
 // hashcash instance
@@ -43,19 +46,19 @@ type hashcash struct {
 func (h *hashcash) compute(preImage string) (string, error) {
 	// hex char: 0    0    0    0    0
 	// binary  : 0000 0000 0000 0000 0000 = 4 bits per char = 20 bits total
+	// Bits below a hex character are matched too, for objects whose work is checked with HasWork
 	var (
-		collisionSize = h.difficulty / bitsPerHexChar
-		header        = h.createHeader()
-		hash          = sha256Hash(header)
+		header = h.createHeader()
+		hash   = sha256Hash(header)
 	)
 	if len(preImage) != len(hash) {
 		return "", ErrInvalidInput
 	}
-	for !acceptableHeader(hash, preImage, collisionSize) {
+	for !matchingBits(hash, preImage, h.difficulty) {
 		h.counter++
 		header = h.createHeader()
 		hash = sha256Hash(header)
-		if h.counter >= maxIterations {
+		if h.counter >= maxIterations && h.counter >= 1<<(h.difficulty+4) {
 			return "", ErrSolutionFail
 		}
 	}
@@ -86,8 +89,35 @@ func verifyProofOfWork(header string, dataBytes []byte) (bool, error) {
 	return true, nil
 }
 
+// Difficulty claimed by a hashcash header, 0 if the header is not in a valid format
+func proofOfWorkDifficulty(header string) int {
+	vals := strings.Split(header, ":")
+	if len(vals) != hashcashLength {
+		return 0
+	}
+	difficulty, err := strconv.Atoi(vals[1])
+	if err != nil || difficulty < 0 {
+		return 0
+	}
+	return difficulty
+}
+
+// Difficulty of the proof of work of nodes, as configured
+func NodeDifficulty() int {
+	diff := configuration.GetMinNodeDifficulty()
+	if diff < MinDifficulty || diff > MaxDifficulty {
+		return stdDifficulty
+	}
+	return diff
+}
+
+// Leading zero bits actually checked for a difficulty, hashes are compared one hex character at a time
+func EffectiveDifficulty(difficulty int) int {
+	return difficulty - difficulty%bitsPerHexChar
+}
+
 // New creates a new Hashcash instance
-func newProofOfWork(dataBytes []byte) (string, error) {
+func newProofOfWork(dataBytes []byte, minDifficulty int) (string, error) {
 	if dataBytes == nil {
 		return "", ErrInvalidInput
 	}
@@ -95,9 +125,9 @@ func newProofOfWork(dataBytes []byte) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	diff := configuration.GetMinNodeDifficulty()
-	if diff < 16 || diff > 28 {
-		diff = stdDifficulty
+	diff := NodeDifficulty()
+	if diff < minDifficulty {
+		diff = minDifficulty
 	}
 	hc := hashcash{
 		difficulty: diff,
@@ -119,6 +149,22 @@ func acceptableHeader(hash string, preImage string, n int) bool {
 	return true
 }
 
+// matchingBits determines if the first 'bits' bits of the hex strings 'hash' and 'preImage' are equal
+func matchingBits(hash string, preImage string, bits int) bool {
+	n := bits / bitsPerHexChar
+	if !acceptableHeader(hash, preImage, n) {
+		return false
+	}
+	rest := bits % bitsPerHexChar
+	if rest == 0 {
+		return true
+	}
+	a, errA := strconv.ParseUint(hash[n:n+1], 16, 8)
+	b, errB := strconv.ParseUint(preImage[n:n+1], 16, 8)
+	shift := uint(bitsPerHexChar - rest)
+	return errA == nil && errB == nil && a>>shift == b>>shift
+}
+
 // createHeader creates a new hashcash header
 func (h *hashcash) createHeader() string {
 	return fmt.Sprintf("%s:%d:%s:%s",
@@ -22,11 +22,29 @@ func (so *SecurityObject) Verify(dataByte []byte) bool {
 	return true
 }
 
+// Number of leading zero bits checked by Verify for the proof of work of the object
+func (so *SecurityObject) Difficulty() int {
+	return EffectiveDifficulty(proofOfWorkDifficulty(so.ProofOfWork))
+}
+
+// Check that the proof of work of the object claims and matches the given number of bits,
+// bits below a hex character included unlike Verify
+func (so *SecurityObject) HasWork(dataBytes []byte, bits int) bool {
+	return proofOfWorkDifficulty(so.ProofOfWork) >= bits &&
+		matchingBits(sha256Hash(so.ProofOfWork), sha256HashFromBytes(dataBytes), bits)
+}
+
 func GenSecurityObject(dataBytes []byte) (SecurityObject, error) {
+	return GenSecurityObjectWithDifficulty(dataBytes, 0)
+}
+
+// Create a security object whose proof of work is at least minDifficulty bits,
+// above the configured difficulty for objects that are costlier to store
+func GenSecurityObjectWithDifficulty(dataBytes []byte, minDifficulty int) (SecurityObject, error) {
 	so := SecurityObject{}
 
 	// 1 Create Proof of Work
-	pow, err := newProofOfWork(dataBytes)
+	pow, err := newProofOfWork(dataBytes, minDifficulty)
 	if err != nil {
 		return SecurityObject{}, err
 	}
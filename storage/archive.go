@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bufio"
+	"dforum-app/configuration"
+	"dforum-app/security"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	archiveFormat  = "dforum-archive"
+	archiveVersion = 1
+	// Max size of a line of an archive, far above the size of a node
+	maxArchiveLine = 16 << 20
+)
+
+var (
+	ErrInvalidArchive = errors.New("not a dforum archive")
+	ErrNodeNotFound   = errors.New("node not found")
+	ErrReadOnly       = errors.New("the database is opened read-only")
+)
+
+// First line of an archive, followed by one node per line as sent on the network.
+// Parents are written before their children.
+type ArchiveHeader struct {
+	Format  string
+	Version int
+	Root    string `json:",omitempty"` // Base64 URL encoded ID of the exported subtree, empty for the whole forum
+	Created int64
+}
+
+type ImportReport struct {
+	Imported int
+	Existing int // Nodes already stored
+	Invalid  int // Nodes that could not be parsed or failed verification, skipped
+}
+
+// Write all nodes, or the subtree of root if set, into an archive.
+// Returns the number of nodes written.
+func (s *StorageModule) ExportArchive(w io.Writer, root *security.HashSignature) (int, error) {
+	header := ArchiveHeader{Format: archiveFormat, Version: archiveVersion, Created: time.Now().Unix()}
+	queue := []security.HashSignature{}
+	if root != nil {
+		if !s.NodeExists(*root) {
+			return 0, ErrNodeNotFound
+		}
+		header.Root = base64.URLEncoding.EncodeToString(root[:])
+		queue = append(queue, *root)
+	} else {
+		// Top level nodes and nodes whose parent is missing are the roots of every stored tree
+		queue = append(queue, s.db.GetChildren(security.HashSignature{})...)
+		queue = append(queue, s.db.GetOrphans()...)
+	}
+
+	bw := bufio.NewWriter(w)
+	headerBytes, _ := json.Marshal(header)
+	if _, err := bw.Write(append(headerBytes, '\n')); err != nil {
+		return 0, err
+	}
+	count := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		n, ok := s.db.GetNode(id)
+		if !ok || n == nil {
+			continue
+		}
+		if _, err := bw.Write(append(n.GetBytes(), '\n')); err != nil {
+			return count, err
+		}
+		count++
+		queue = append(queue, s.db.GetChildren(id)...)
+	}
+	return count, bw.Flush()
+}
+
+// Store the nodes of an archive, every node being verified first.
+// Imported nodes are not published, they are shared with peers as they sync.
+func (s *StorageModule) ImportArchive(r io.Reader) (ImportReport, error) {
+	report := ImportReport{}
+	if s.readOnly {
+		return report, ErrReadOnly
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxArchiveLine)
+	var header ArchiveHeader
+	if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &header) != nil || header.Format != archiveFormat {
+		return report, ErrInvalidArchive
+	}
+	if header.Version > archiveVersion {
+		return report, errors.New("unsupported archive version")
+	}
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		n := ParseNode(scanner.Bytes())
+		switch {
+		case n == nil || !n.Verify():
+			report.Invalid++
+		case s.NodeExists(n.GetFingerprint()):
+			report.Existing++
+		default:
+			s.StoreNode(n)
+			report.Imported++
+		}
+	}
+	configuration.Logger.Infof("imported %d nodes from an archive, %d already stored, %d invalid",
+		report.Imported, report.Existing, report.Invalid)
+	return report, scanner.Err()
+}
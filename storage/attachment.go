@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"dforum-app/configuration"
+	"dforum-app/security"
+	"errors"
+	"math/bits"
+)
+
+/*
+	Attachments are files referenced from nodes by the hash of their content.
+	Their content is split into chunks stored apart from nodes and fetched from peers when opened,
+	each chunk being verified against the chunk hashes listed in the node.
+*/
+
+const (
+	AttachmentChunkSize = 256 << 10
+	MaxAttachments      = 4 // Per node
+	// Largest attachments accepted in nodes, keeping nodes within the size of network messages.
+	// Smaller limits are set by the config for creating and fetching attachments.
+	maxAttachmentSize = 32 << 20
+	maxNodeChunks     = maxAttachmentSize / AttachmentChunkSize
+	maxAttachmentName = 255
+)
+
+var (
+	ErrAttachmentTooLarge   = errors.New("attachment exceeds the maximum size")
+	ErrInvalidChunk         = errors.New("chunk does not match the attachment")
+	ErrAttachmentIncomplete = errors.New("attachment is not fully stored")
+	ErrAttachmentCorrupted  = errors.New("attachment content does not match its hash")
+	ErrAttachmentFetching   = errors.New("attachment is already being fetched")
+	ErrAttachmentNoPeer     = errors.New("no peer could serve the attachment")
+)
+
+type Attachment struct {
+	Hash      security.HashSignature // SHA-224 of the whole content
+	Name      string
+	MediaType string
+	Size      int64
+	Chunks    []security.HashSignature // SHA-224 of each chunk, in order
+}
+
+// Fetches chunks of attachments from peers, storing them with StoreChunk
+type AttachmentFetcher interface {
+	FetchChunk(a Attachment, index int) bool
+}
+
+// Describe a file to be attached to a node, its content is stored with StoreAttachment
+func NewAttachment(name string, mediaType string, content []byte) (Attachment, error) {
+	if int64(len(content)) > configuration.GetMaxAttachmentSize() || len(content) > maxAttachmentSize {
+		return Attachment{}, ErrAttachmentTooLarge
+	}
+	a := Attachment{
+		Hash:      sha256.Sum224(content),
+		Name:      name,
+		MediaType: mediaType,
+		Size:      int64(len(content)),
+		Chunks:    []security.HashSignature{},
+	}
+	for _, chunk := range splitChunks(content) {
+		a.Chunks = append(a.Chunks, sha256.Sum224(chunk))
+	}
+	if !a.IsValid() {
+		return Attachment{}, errors.New("invalid attachment")
+	}
+	return a, nil
+}
+
+// Check the description of an attachment received from a peer
+func (a *Attachment) IsValid() bool {
+	return a.Size > 0 && a.Size <= maxAttachmentSize &&
+		len(a.Name) > 0 && len(a.Name) <= maxAttachmentName && len(a.MediaType) <= maxAttachmentName &&
+		len(a.Chunks) == chunkCount(a.Size)
+}
+
+// Check the attachments of a node, they may not list more than maxNodeChunks chunks in total
+func validAttachments(attachments []Attachment) bool {
+	if len(attachments) > MaxAttachments {
+		return false
+	}
+	chunks := 0
+	for _, a := range attachments {
+		if !a.IsValid() {
+			return false
+		}
+		chunks += len(a.Chunks)
+	}
+	return chunks <= maxNodeChunks
+}
+
+// Size of a chunk, only the last one is smaller than AttachmentChunkSize
+func (a *Attachment) ChunkSize(index int) int {
+	if index == len(a.Chunks)-1 {
+		return int(a.Size - int64(index)*AttachmentChunkSize)
+	}
+	return AttachmentChunkSize
+}
+
+// Proof of work required from nodes with attachments: one bit above the base difficulty of nodes,
+// and one more each time their total number of chunks grows 4 times, up to security.MaxDifficulty.
+// Returns 0 for nodes without attachments.
+func RequiredDifficulty(attachments []Attachment, base int) int {
+	if len(attachments) == 0 {
+		return 0
+	}
+	chunks := 0
+	for _, a := range attachments {
+		chunks += len(a.Chunks)
+	}
+	required := base + 1 + bits.Len(uint(chunks-1))/2
+	if required > security.MaxDifficulty {
+		return security.MaxDifficulty
+	}
+	return required
+}
+
+func chunkCount(size int64) int {
+	return int((size + AttachmentChunkSize - 1) / AttachmentChunkSize)
+}
+
+func splitChunks(content []byte) [][]byte {
+	chunks := [][]byte{}
+	for start := 0; start < len(content); start += AttachmentChunkSize {
+		end := start + AttachmentChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		chunks = append(chunks, content[start:end])
+	}
+	return chunks
+}
+
+// Attachment of a node with the given hash
+func (n *Node) GetAttachment(hash security.HashSignature) (Attachment, bool) {
+	for _, a := range n.DatObj.Attachments {
+		if a.Hash == hash {
+			return a, true
+		}
+	}
+	return Attachment{}, false
+}
+
+// Store the whole content of an attachment created locally
+func (s *StorageModule) StoreAttachment(a Attachment, content []byte) error {
+	if sha256.Sum224(content) != a.Hash {
+		return ErrAttachmentCorrupted
+	}
+	for i, chunk := range splitChunks(content) {
+		if err := s.StoreChunk(a, i, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Store a chunk of an attachment after checking it against the hashes of the attachment
+func (s *StorageModule) StoreChunk(a Attachment, index int, chunk []byte) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if index < 0 || index >= len(a.Chunks) || len(chunk) != a.ChunkSize(index) || sha256.Sum224(chunk) != a.Chunks[index] {
+		return ErrInvalidChunk
+	}
+	if !s.db.StoreChunk(a.Hash, index, chunk) {
+		return errors.New("could not store the chunk")
+	}
+	return nil
+}
+
+// Chunk of an attachment to be shared with peers
+func (s *StorageModule) GetChunk(hash security.HashSignature, index int) ([]byte, bool) {
+	return s.db.GetChunk(hash, index)
+}
+
+// Number of chunks of an attachment stored locally
+func (s *StorageModule) StoredChunks(a Attachment) int {
+	stored := 0
+	for i := range a.Chunks {
+		if s.db.HasChunk(a.Hash, i) {
+			stored++
+		}
+	}
+	return stored
+}
+
+// Whole content of an attachment, verified against its hash
+func (s *StorageModule) GetAttachmentContent(a Attachment) ([]byte, error) {
+	content := bytes.Buffer{}
+	content.Grow(int(a.Size))
+	for i := range a.Chunks {
+		chunk, ok := s.db.GetChunk(a.Hash, i)
+		if !ok {
+			return nil, ErrAttachmentIncomplete
+		}
+		content.Write(chunk)
+	}
+	// Chunks match the node, but the node may list chunks of another content
+	if sha256.Sum224(content.Bytes()) != a.Hash {
+		return nil, ErrAttachmentCorrupted
+	}
+	return content.Bytes(), nil
+}
+
+// Set the fetcher of missing chunks, attachments can only be read from the local storage without it
+func (s *StorageModule) SetAttachmentFetcher(f AttachmentFetcher) {
+	s.fetcher = f
+}
+
+// Fetch the missing chunks of an attachment one at a time, reporting the number of chunks stored
+// after each of them. Attachments above the configured size are not fetched.
+func (s *StorageModule) FetchAttachment(a Attachment, progress func(stored int, total int)) error {
+	if !a.IsValid() || a.Size > configuration.GetMaxAttachmentSize() {
+		return ErrAttachmentTooLarge
+	}
+	s.fetchLock.Lock()
+	if s.fetching[a.Hash] {
+		s.fetchLock.Unlock()
+		return ErrAttachmentFetching
+	}
+	s.fetching[a.Hash] = true
+	s.fetchLock.Unlock()
+	defer func() {
+		s.fetchLock.Lock()
+		delete(s.fetching, a.Hash)
+		s.fetchLock.Unlock()
+	}()
+
+	stored := s.StoredChunks(a)
+	progress(stored, len(a.Chunks))
+	for i := range a.Chunks {
+		if s.db.HasChunk(a.Hash, i) {
+			continue
+		}
+		if s.fetcher == nil || !s.fetcher.FetchChunk(a, i) {
+			return ErrAttachmentNoPeer
+		}
+		stored++
+		progress(stored, len(a.Chunks))
+	}
+	return nil
+}
@@ -9,9 +9,30 @@ type Database interface {
 	HasNode(security.HashSignature) bool
 	GetNode(security.HashSignature) (*Node, bool)
 	GetChildren(security.HashSignature) []security.HashSignature
+	GetAllNodeIDs() []security.HashSignature
 	GetAllNodesSince(time.Time) []security.HashSignature
+	WalkNodesNewestFirst(visit func(security.HashSignature) bool)
 	StoreNode(*Node) bool
 	TimeOfMostRecentNode() time.Time
+	StoreWant(security.HashSignature, []byte) bool
+	DeleteWant(security.HashSignature)
+	GetAllWants() map[security.HashSignature][]byte
+	StoreOrphan(parent security.HashSignature, child security.HashSignature) bool
+	DeleteOrphans(parent security.HashSignature)
+	GetOrphans() []security.HashSignature
+	StoreBan(peer string, until time.Time) bool
+	DeleteBan(peer string)
+	GetAllBans() map[string]time.Time
+	StorePeerRecord(peer string, record []byte) bool
+	DeletePeerRecord(peer string)
+	GetAllPeerRecords() map[string][]byte
+	StoreNodeStats(security.HashSignature, []byte) bool
+	GetNodeStats(security.HashSignature) ([]byte, bool)
+	HasNodeStats() bool
+	StoreChunk(attachment security.HashSignature, index int, chunk []byte) bool
+	GetChunk(attachment security.HashSignature, index int) ([]byte, bool)
+	HasChunk(attachment security.HashSignature, index int) bool
+	DeleteChunks(attachment security.HashSignature)
 	InitDatabase(pathToFiles string) error
 	Close()
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
@@ -17,6 +18,20 @@ type LevelDbImpl struct {
 	edgeDB *leveldb.DB
 	// This database indexes node hash values by time stamp.
 	timestampDB *leveldb.DB
+	// This database stores hashes of nodes announced by peers but not yet fetched, with the peers known to have them.
+	wantDB *leveldb.DB
+	// This database stores nodes whose parent is unknown locally, the key = missing parent hash + child hash.
+	orphanDB *leveldb.DB
+	// This database stores banned peer IDs with the unix time at which their ban ends.
+	banDB *leveldb.DB
+	// This database is the address book of peers, storing their addresses and connection history by peer ID.
+	peerDB *leveldb.DB
+	// This database stores counters maintained for each node as its descendants are stored, see NodeStats.
+	// Unset when opening a read only database created before it existed.
+	statsDB *leveldb.DB
+	// This database stores the chunks of attachments, the key = attachment hash + big endian chunk index.
+	// Unset when opening a read only database created before it existed.
+	chunkDB *leveldb.DB
 }
 
 func NewLevelDbImpl() *LevelDbImpl {
@@ -38,6 +53,21 @@ func (db *LevelDbImpl) GetNode(id security.HashSignature) (*Node, bool) {
 	return node, true
 }
 
+func (db *LevelDbImpl) GetAllNodeIDs() []security.HashSignature {
+	nodes := []security.HashSignature{}
+
+	iter := db.nodeDB.NewIterator(nil, nil)
+	for iter.Next() {
+		if len(iter.Key()) != 28 {
+			continue
+		}
+		nodes = append(nodes, *(*[28]byte)(iter.Key()))
+	}
+	iter.Release()
+
+	return nodes
+}
+
 func (db *LevelDbImpl) GetChildren(id security.HashSignature) []security.HashSignature {
 	children := []security.HashSignature{}
 
@@ -55,8 +85,9 @@ func (db *LevelDbImpl) GetAllNodesSince(t time.Time) []security.HashSignature {
 
 	timeStart := make([]byte, 8)
 	binary.BigEndian.PutUint64(timeStart, uint64(t.Unix()))
+	// Keys are prefixed by the timestamp, nodes of the current second sort after it
 	timeEnd := make([]byte, 8)
-	binary.BigEndian.PutUint64(timeEnd, uint64(time.Now().Unix()))
+	binary.BigEndian.PutUint64(timeEnd, uint64(time.Now().Unix()+1))
 
 	iter := db.timestampDB.NewIterator(&util.Range{Start: timeStart, Limit: timeEnd}, nil)
 
@@ -68,6 +99,20 @@ func (db *LevelDbImpl) GetAllNodesSince(t time.Time) []security.HashSignature {
 	return nodes
 }
 
+// Visit nodes by descending timestamp until visit returns false
+func (db *LevelDbImpl) WalkNodesNewestFirst(visit func(security.HashSignature) bool) {
+	iter := db.timestampDB.NewIterator(nil, nil)
+	defer iter.Release()
+	for ok := iter.Last(); ok; ok = iter.Prev() {
+		if len(iter.Key()) != 8+28 {
+			continue
+		}
+		if !visit(*(*[28]byte)(iter.Key()[8:])) {
+			return
+		}
+	}
+}
+
 func (db *LevelDbImpl) StoreNode(n *Node) bool {
 	nodeId := n.GetFingerprint()
 	// Add node's timestamp index to the time indexed table
@@ -101,24 +146,274 @@ func (db *LevelDbImpl) TimeOfMostRecentNode() time.Time {
 	return time.Unix(epochTime, 0)
 }
 
+func (db *LevelDbImpl) StoreWant(id security.HashSignature, want []byte) bool {
+	if err := db.wantDB.Put(id[:], want, nil); err != nil {
+		configuration.Logger.Errorf("could not add the want %s to the database: %s", id[0:4], err.Error())
+		return false
+	}
+	return true
+}
+
+func (db *LevelDbImpl) DeleteWant(id security.HashSignature) {
+	if err := db.wantDB.Delete(id[:], nil); err != nil {
+		configuration.Logger.Errorf("could not delete the want %s from the database: %s", id[0:4], err.Error())
+	}
+}
+
+func (db *LevelDbImpl) GetAllWants() map[security.HashSignature][]byte {
+	wants := make(map[security.HashSignature][]byte)
+
+	if db.wantDB == nil {
+		return wants
+	}
+	iter := db.wantDB.NewIterator(nil, nil)
+	for iter.Next() {
+		if len(iter.Key()) != 28 {
+			continue
+		}
+		value := make([]byte, len(iter.Value()))
+		copy(value, iter.Value())
+		wants[*(*[28]byte)(iter.Key())] = value
+	}
+	iter.Release()
+
+	return wants
+}
+
+func (db *LevelDbImpl) StoreOrphan(parent security.HashSignature, child security.HashSignature) bool {
+	if err := db.orphanDB.Put(append(parent[:], child[:]...), nil, nil); err != nil {
+		configuration.Logger.Errorf("could not add the orphan %s to the database: %s", child[0:4], err.Error())
+		return false
+	}
+	return true
+}
+
+func (db *LevelDbImpl) DeleteOrphans(parent security.HashSignature) {
+	batch := new(leveldb.Batch)
+	iter := db.orphanDB.NewIterator(util.BytesPrefix(parent[:]), nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if batch.Len() == 0 {
+		return
+	}
+	if err := db.orphanDB.Write(batch, nil); err != nil {
+		configuration.Logger.Errorf("could not delete the orphans of %s from the database: %s", parent[0:4], err.Error())
+	}
+}
+
+func (db *LevelDbImpl) GetOrphans() []security.HashSignature {
+	orphans := []security.HashSignature{}
+
+	if db.orphanDB == nil {
+		return orphans
+	}
+	iter := db.orphanDB.NewIterator(nil, nil)
+	for iter.Next() {
+		orphans = append(orphans, *(*[28]byte)(iter.Key()[28:56]))
+	}
+	iter.Release()
+
+	return orphans
+}
+
+func (db *LevelDbImpl) StoreBan(peer string, until time.Time) bool {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(until.Unix()))
+	if err := db.banDB.Put([]byte(peer), value, nil); err != nil {
+		configuration.Logger.Errorf("could not add the ban of %s to the database: %s", peer, err.Error())
+		return false
+	}
+	return true
+}
+
+func (db *LevelDbImpl) DeleteBan(peer string) {
+	if err := db.banDB.Delete([]byte(peer), nil); err != nil {
+		configuration.Logger.Errorf("could not delete the ban of %s from the database: %s", peer, err.Error())
+	}
+}
+
+func (db *LevelDbImpl) GetAllBans() map[string]time.Time {
+	bans := make(map[string]time.Time)
+
+	if db.banDB == nil {
+		return bans
+	}
+	iter := db.banDB.NewIterator(nil, nil)
+	for iter.Next() {
+		if len(iter.Value()) != 8 {
+			continue
+		}
+		bans[string(iter.Key())] = time.Unix(int64(binary.BigEndian.Uint64(iter.Value())), 0)
+	}
+	iter.Release()
+
+	return bans
+}
+
+func (db *LevelDbImpl) StorePeerRecord(peer string, record []byte) bool {
+	if err := db.peerDB.Put([]byte(peer), record, nil); err != nil {
+		configuration.Logger.Errorf("could not add the peer %s to the database: %s", peer, err.Error())
+		return false
+	}
+	return true
+}
+
+func (db *LevelDbImpl) DeletePeerRecord(peer string) {
+	if err := db.peerDB.Delete([]byte(peer), nil); err != nil {
+		configuration.Logger.Errorf("could not delete the peer %s from the database: %s", peer, err.Error())
+	}
+}
+
+func (db *LevelDbImpl) GetAllPeerRecords() map[string][]byte {
+	records := make(map[string][]byte)
+
+	if db.peerDB == nil {
+		return records
+	}
+	iter := db.peerDB.NewIterator(nil, nil)
+	for iter.Next() {
+		value := make([]byte, len(iter.Value()))
+		copy(value, iter.Value())
+		records[string(iter.Key())] = value
+	}
+	iter.Release()
+
+	return records
+}
+
+func (db *LevelDbImpl) StoreNodeStats(id security.HashSignature, stats []byte) bool {
+	if err := db.statsDB.Put(id[:], stats, nil); err != nil {
+		configuration.Logger.Errorf("could not add the stats of node %s to the database: %s", id[0:4], err.Error())
+		return false
+	}
+	return true
+}
+
+func (db *LevelDbImpl) GetNodeStats(id security.HashSignature) ([]byte, bool) {
+	if db.statsDB == nil {
+		return nil, false
+	}
+	stats, err := db.statsDB.Get(id[:], nil)
+	if err != nil {
+		return nil, false
+	}
+	return stats, true
+}
+
+// Check whether any node stats are stored, they are missing from databases created before they existed
+func (db *LevelDbImpl) HasNodeStats() bool {
+	if db.statsDB == nil {
+		return false
+	}
+	iter := db.statsDB.NewIterator(nil, nil)
+	defer iter.Release()
+	return iter.First()
+}
+
+func (db *LevelDbImpl) StoreChunk(attachment security.HashSignature, index int, chunk []byte) bool {
+	if err := db.chunkDB.Put(chunkKey(attachment, index), chunk, nil); err != nil {
+		configuration.Logger.Errorf("could not add chunk %d of attachment %s to the database: %s", index, attachment[0:4], err.Error())
+		return false
+	}
+	return true
+}
+
+func (db *LevelDbImpl) GetChunk(attachment security.HashSignature, index int) ([]byte, bool) {
+	if db.chunkDB == nil {
+		return nil, false
+	}
+	chunk, err := db.chunkDB.Get(chunkKey(attachment, index), nil)
+	if err != nil {
+		return nil, false
+	}
+	return chunk, true
+}
+
+func (db *LevelDbImpl) HasChunk(attachment security.HashSignature, index int) bool {
+	if db.chunkDB == nil {
+		return false
+	}
+	ok, _ := db.chunkDB.Has(chunkKey(attachment, index), nil)
+	return ok
+}
+
+func (db *LevelDbImpl) DeleteChunks(attachment security.HashSignature) {
+	iter := db.chunkDB.NewIterator(util.BytesPrefix(attachment[:]), nil)
+	for iter.Next() {
+		db.chunkDB.Delete(iter.Key(), nil)
+	}
+	iter.Release()
+}
+
+func chunkKey(attachment security.HashSignature, index int) []byte {
+	key := make([]byte, 28+4)
+	copy(key, attachment[:])
+	binary.BigEndian.PutUint32(key[28:], uint32(index))
+	return key
+}
+
 func (db *LevelDbImpl) InitDatabase(pathToFiles string) error {
+	return db.openFiles(pathToFiles, nil)
+}
+
+// Open existing databases without modifying them, other processes may read them at the same time
+func (db *LevelDbImpl) InitReadOnlyDatabase(pathToFiles string) error {
+	return db.openFiles(pathToFiles, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+}
+
+func (db *LevelDbImpl) openFiles(pathToFiles string, o *opt.Options) error {
 	// Open DB Files
-	nodes, err := leveldb.OpenFile(pathToFiles+"appdata.db", nil)
+	nodes, err := leveldb.OpenFile(pathToFiles+"appdata.db", o)
 	if err != nil {
 		return err
 	}
-	edges, err := leveldb.OpenFile(pathToFiles+"datarelation.db", nil)
+	edges, err := leveldb.OpenFile(pathToFiles+"datarelation.db", o)
 	if err != nil {
 		return err
 	}
-	timestamps, err := leveldb.OpenFile(pathToFiles+"datatimestamps.db", nil)
+	timestamps, err := leveldb.OpenFile(pathToFiles+"datatimestamps.db", o)
 	if err != nil {
 		return err
 	}
+	// The other databases may not have been created yet by the process owning them,
+	// reading without them is fine
+	readOnly := o != nil && o.ReadOnly
+	wants, err := leveldb.OpenFile(pathToFiles+"datawants.db", o)
+	if err != nil && !readOnly {
+		return err
+	}
+	orphans, err := leveldb.OpenFile(pathToFiles+"dataorphans.db", o)
+	if err != nil && !readOnly {
+		return err
+	}
+	bans, err := leveldb.OpenFile(pathToFiles+"peerbans.db", o)
+	if err != nil && !readOnly {
+		return err
+	}
+	peers, err := leveldb.OpenFile(pathToFiles+"peerbook.db", o)
+	if err != nil && !readOnly {
+		return err
+	}
+	stats, err := leveldb.OpenFile(pathToFiles+"datastats.db", o)
+	if err != nil && !readOnly {
+		return err
+	}
+	chunks, err := leveldb.OpenFile(pathToFiles+"attachments.db", o)
+	if err != nil && !readOnly {
+		return err
+	}
 	// Set the databases
 	db.nodeDB = nodes
 	db.edgeDB = edges
 	db.timestampDB = timestamps
+	db.wantDB = wants
+	db.orphanDB = orphans
+	db.banDB = bans
+	db.peerDB = peers
+	db.statsDB = stats
+	db.chunkDB = chunks
 
 	return nil
 }
@@ -127,4 +422,10 @@ func (db *LevelDbImpl) Close() {
 	db.nodeDB.Close()
 	db.edgeDB.Close()
 	db.timestampDB.Close()
+	// Optional databases of read-only mode may be missing
+	for _, optional := range []*leveldb.DB{db.wantDB, db.orphanDB, db.banDB, db.peerDB, db.statsDB, db.chunkDB} {
+		if optional != nil {
+			optional.Close()
+		}
+	}
 }
@@ -14,6 +14,10 @@ type DataObject struct {
 	Topic     string
 	Indicator int8
 	Content   string
+	// Omitted when empty, leaving the bytes of ordinary nodes unchanged
+	Attachments []Attachment `json:",omitempty"`
+	Poll        *Poll        `json:",omitempty"` // Set for polls
+	Vote        *Vote        `json:",omitempty"` // Set for votes, their parent being the poll
 }
 
 func (do DataObject) GetBytes() []byte {
@@ -31,24 +35,46 @@ type Node struct {
 }
 
 func NewNode(topic string, detail string, indicator int8, parentHash [28]byte) *Node {
-	do := DataObject{
-		Parent:    parentHash,
-		Timestamp: time.Now().Unix(),
-		Topic:     topic,
-		Indicator: indicator,
-		Content:   detail,
+	return NewNodeWithAttachments(topic, detail, indicator, parentHash, nil)
+}
+
+// Create a node referencing attachments, their content being stored separately.
+// The proof of work grows with the size of the attachments.
+func NewNodeWithAttachments(topic string, detail string, indicator int8, parentHash [28]byte, attachments []Attachment) *Node {
+	if !validAttachments(attachments) {
+		configuration.Logger.Errorf("failed to create node with title: %s - invalid attachments", topic)
+		return nil
 	}
-	security, err := security.GenSecurityObject(do.GetBytes())
+	return newNode(DataObject{
+		Parent:      parentHash,
+		Timestamp:   time.Now().Unix(),
+		Topic:       topic,
+		Indicator:   indicator,
+		Content:     detail,
+		Attachments: attachments,
+	})
+}
+
+func newNode(do DataObject) *Node {
+	security, err := security.GenSecurityObjectWithDifficulty(do.GetBytes(), RequiredDifficulty(do.Attachments, security.NodeDifficulty()))
 	if err != nil {
-		configuration.Logger.Errorf("failed to create node with title: %s - %ss", topic, err.Error())
+		configuration.Logger.Errorf("failed to create node with title: %s - %ss", do.Topic, err.Error())
 		return nil
 	}
-	configuration.Logger.Info("successfully created node with title: ", topic)
+	configuration.Logger.Info("successfully created node with title: ", do.Topic)
 	return &Node{SecObj: security, DatObj: do}
 }
 
 func (n *Node) Verify() bool {
-	return n.SecObj.Verify(n.DatObj.GetBytes())
+	if !validAttachments(n.DatObj.Attachments) || !validPollData(n.DatObj) {
+		return false
+	}
+	dataBytes := n.DatObj.GetBytes()
+	// Peers may configure different difficulties, only the lowest one can be required from them
+	if len(n.DatObj.Attachments) > 0 && !n.SecObj.HasWork(dataBytes, RequiredDifficulty(n.DatObj.Attachments, security.MinDifficulty)) {
+		return false
+	}
+	return n.SecObj.Verify(dataBytes)
 }
 
 func (n Node) GetBytes() []byte {
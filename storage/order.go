@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	"dforum-app/security"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+)
+
+// Order in which nodes are listed
+type SortOrder string
+
+const (
+	OrderNewest    SortOrder = "newest"
+	OrderOldest    SortOrder = "oldest"
+	OrderActive    SortOrder = "active"    // Most descendants first
+	OrderAgreed    SortOrder = "agreed"    // Most agreeing replies first
+	OrderContested SortOrder = "contested" // Most evenly split replies first
+	// Random order derived from a seed, stable as long as the seed is kept so that
+	// no node is consistently listed first
+	OrderRandom SortOrder = "random"
+)
+
+// Returns false for unknown orders
+func ParseSortOrder(order string) (SortOrder, bool) {
+	switch o := SortOrder(order); o {
+	case OrderNewest, OrderOldest, OrderActive, OrderAgreed, OrderContested, OrderRandom:
+		return o, true
+	}
+	return OrderRandom, false
+}
+
+// Sort nodes in place. Ties are broken by fingerprint so that the result only
+// depends on the nodes, their stats and the seed.
+func (s *StorageModule) SortNodes(nodes []*Node, order SortOrder, seed uint64) {
+	keys := make(map[*Node]sortKey, len(nodes))
+	for _, n := range nodes {
+		if n != nil {
+			keys[n] = s.newSortKey(n, order, seed)
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i] == nil || nodes[j] == nil {
+			return nodes[j] == nil && nodes[i] != nil
+		}
+		a, b := keys[nodes[i]], keys[nodes[j]]
+		if a.primary != b.primary {
+			return a.primary > b.primary
+		}
+		if a.secondary != b.secondary {
+			return a.secondary > b.secondary
+		}
+		fa, fb := nodes[i].GetFingerprint(), nodes[j].GetFingerprint()
+		return bytes.Compare(fa[:], fb[:]) < 0
+	})
+}
+
+// Children of a node in a given order, votes excluded, fetching all children before keeping the first max ones
+func (s *StorageModule) GetSortedChildrenNodes(parent security.HashSignature, order SortOrder, seed uint64, max int) []*Node {
+	nodes := []*Node{}
+	for _, id := range s.db.GetChildren(parent) {
+		if n := s.GetNode(id, false); n != nil && !n.IsVote() {
+			nodes = append(nodes, n)
+		}
+	}
+	s.SortNodes(nodes, order, seed)
+	if max > 0 && len(nodes) > max {
+		nodes = nodes[:max]
+	}
+	return nodes
+}
+
+// Nodes are sorted by descending keys
+type sortKey struct {
+	primary   int64
+	secondary int64
+}
+
+func (s *StorageModule) newSortKey(n *Node, order SortOrder, seed uint64) sortKey {
+	switch order {
+	case OrderNewest:
+		return sortKey{primary: n.GetTimestamp()}
+	case OrderOldest:
+		return sortKey{primary: -n.GetTimestamp()}
+	}
+	if order != OrderActive && order != OrderAgreed && order != OrderContested {
+		return sortKey{primary: randomRank(n, seed)}
+	}
+	stats := s.GetNodeStats(n.GetFingerprint())
+	switch order {
+	case OrderActive:
+		return sortKey{primary: int64(stats.Descendants), secondary: stats.LastActivity}
+	case OrderAgreed:
+		return sortKey{primary: int64(stats.Agreeing - stats.Disagreeing), secondary: int64(stats.Agreeing)}
+	}
+	// The smaller side of a split discussion, then the number of opinions
+	contested := stats.Agreeing
+	if stats.Disagreeing < contested {
+		contested = stats.Disagreeing
+	}
+	return sortKey{primary: int64(contested), secondary: int64(stats.Agreeing + stats.Disagreeing)}
+}
+
+func randomRank(n *Node, seed uint64) int64 {
+	h := fnv.New64a()
+	seedBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(seedBytes, seed)
+	h.Write(seedBytes)
+	fingerprint := n.GetFingerprint()
+	h.Write(fingerprint[:])
+	return int64(h.Sum64() >> 1)
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"dforum-app/security"
+	"encoding/binary"
+	"errors"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+	Polls are nodes listing options, votes are replies to a poll naming one of its options.
+	Nodes are anonymous, so votes carry a voter pseudonym: a public key derived from a secret of the voter
+	and the poll, which signs the vote. The latest vote of each pseudonym is counted, which lets voters
+	change their vote without letting anyone else change it, but does not prevent a determined voter
+	from voting again under new pseudonyms.
+	Each vote costing a proof of work like any node makes doing so at scale expensive.
+*/
+
+const (
+	MinPollOptions      = 2
+	MaxPollOptions      = 16
+	maxPollOptionLength = 200
+	// Votes further in the future than this are not counted
+	maxVoteClockSkew = time.Hour
+)
+
+var (
+	ErrNotAPoll    = errors.New("node is not a poll")
+	ErrInvalidPoll = errors.New("invalid poll")
+)
+
+type Poll struct {
+	Options []string
+	Closes  int64 `json:",omitempty"` // Unix time after which votes are not counted, 0 for open polls
+}
+
+type Vote struct {
+	Option    int    // Index of the option chosen
+	Voter     []byte // Pseudonym of the voter for this poll, see VoterID
+	Signature []byte // Signature of the poll, option and timestamp by the voter
+}
+
+type PollResults struct {
+	Options []string
+	Counts  []int // Votes counted for each option
+	Votes   int   // Votes counted
+	// Votes replaced by a later vote of the same voter
+	Duplicates int
+	// Votes for unknown options, cast before the poll, after it closed or too far in the future
+	Invalid int
+	Closed  bool
+}
+
+// Pseudonym of a voter for a poll, votes of a voter on different polls cannot be linked
+func VoterID(secret []byte, poll security.HashSignature) []byte {
+	return voterKey(secret, poll).Public().(ed25519.PublicKey)
+}
+
+func voterKey(secret []byte, poll security.HashSignature) ed25519.PrivateKey {
+	seed := sha256.Sum256(append(append([]byte{}, secret...), poll[:]...))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// Bytes signed by a voter, the timestamp is included so that a vote cannot be replayed as a later one
+func voteMessage(poll security.HashSignature, option int, timestamp int64) []byte {
+	msg := make([]byte, len(poll)+12)
+	copy(msg, poll[:])
+	binary.BigEndian.PutUint32(msg[len(poll):], uint32(option))
+	binary.BigEndian.PutUint64(msg[len(poll)+4:], uint64(timestamp))
+	return msg
+}
+
+func (p *Poll) IsValid() bool {
+	if len(p.Options) < MinPollOptions || len(p.Options) > MaxPollOptions || p.Closes < 0 {
+		return false
+	}
+	for _, option := range p.Options {
+		if option == "" || utf8.RuneCountInString(option) > maxPollOptionLength {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *Node) IsPoll() bool {
+	return n.DatObj.Poll != nil
+}
+
+func (n *Node) IsVote() bool {
+	return n.DatObj.Vote != nil
+}
+
+// A node is either a poll, a vote or an ordinary post
+func validPollData(do DataObject) bool {
+	switch {
+	case do.Poll != nil && do.Vote != nil:
+		return false
+	case do.Poll != nil:
+		return do.Poll.IsValid()
+	case do.Vote != nil:
+		v := do.Vote
+		return v.Option >= 0 && v.Option < MaxPollOptions && do.Parent != security.HashSignature{} &&
+			len(v.Voter) == ed25519.PublicKeySize && len(v.Signature) == ed25519.SignatureSize &&
+			ed25519.Verify(v.Voter, voteMessage(do.Parent, v.Option, do.Timestamp), v.Signature)
+	}
+	return true
+}
+
+// Create a poll, as a topic or as a reply to another node
+func NewPollNode(topic string, detail string, indicator int8, parentHash [28]byte, poll Poll) *Node {
+	if !poll.IsValid() {
+		return nil
+	}
+	return newNode(DataObject{
+		Parent:    parentHash,
+		Timestamp: time.Now().Unix(),
+		Topic:     topic,
+		Indicator: indicator,
+		Content:   detail,
+		Poll:      &poll,
+	})
+}
+
+// Create a vote replying to a poll, signed with the key of the voter for the poll.
+// Votes have no opinion on the poll itself.
+func NewVoteNode(poll security.HashSignature, option int, secret []byte) *Node {
+	return newVoteNode(poll, option, secret, time.Now().Unix())
+}
+
+func newVoteNode(poll security.HashSignature, option int, secret []byte, timestamp int64) *Node {
+	key := voterKey(secret, poll)
+	return newNode(DataObject{
+		Parent:    poll,
+		Timestamp: timestamp,
+		Indicator: -1,
+		Vote: &Vote{
+			Option:    option,
+			Voter:     key.Public().(ed25519.PublicKey),
+			Signature: ed25519.Sign(key, voteMessage(poll, option, timestamp)),
+		},
+	})
+}
+
+// Count the votes stored for a poll, keeping the latest vote of each voter
+func (s *StorageModule) TallyPoll(id security.HashSignature) (PollResults, error) {
+	poll := s.GetNode(id, false)
+	if poll == nil {
+		return PollResults{}, ErrNodeNotFound
+	}
+	if !poll.IsPoll() {
+		return PollResults{}, ErrNotAPoll
+	}
+	return tallyVotes(poll, s.getVotes(id), time.Now()), nil
+}
+
+// Option of the latest vote of a voter on a poll, whether it is counted or not
+func (s *StorageModule) GetVoterChoice(poll security.HashSignature, voter []byte) (int, bool) {
+	var latest *Node
+	for _, v := range s.getVotes(poll) {
+		if bytes.Equal(v.DatObj.Vote.Voter, voter) && (latest == nil || laterVote(v, latest)) {
+			latest = v
+		}
+	}
+	if latest == nil {
+		return 0, false
+	}
+	return latest.DatObj.Vote.Option, true
+}
+
+func (s *StorageModule) getVotes(poll security.HashSignature) []*Node {
+	votes := []*Node{}
+	for _, id := range s.db.GetChildren(poll) {
+		if n := s.GetNode(id, false); n != nil && n.IsVote() {
+			votes = append(votes, n)
+		}
+	}
+	return votes
+}
+
+func tallyVotes(poll *Node, votes []*Node, now time.Time) PollResults {
+	options := poll.DatObj.Poll.Options
+	closes := poll.DatObj.Poll.Closes
+	results := PollResults{
+		Options: options,
+		Counts:  make([]int, len(options)),
+		Closed:  closes > 0 && now.Unix() > closes,
+	}
+	latest := map[string]*Node{}
+	for _, v := range votes {
+		vote := v.DatObj.Vote
+		timestamp := v.GetTimestamp()
+		if vote.Option >= len(options) || timestamp < poll.GetTimestamp() ||
+			(closes > 0 && timestamp > closes) || timestamp > now.Add(maxVoteClockSkew).Unix() {
+			results.Invalid++
+			continue
+		}
+		previous, ok := latest[string(vote.Voter)]
+		if ok {
+			results.Duplicates++
+			if !laterVote(v, previous) {
+				continue
+			}
+		}
+		latest[string(vote.Voter)] = v
+	}
+	for _, v := range latest {
+		results.Counts[v.DatObj.Vote.Option]++
+		results.Votes++
+	}
+	return results
+}
+
+// Ties are broken by fingerprint so that every peer counts the same vote
+func laterVote(a *Node, b *Node) bool {
+	if a.GetTimestamp() != b.GetTimestamp() {
+		return a.GetTimestamp() > b.GetTimestamp()
+	}
+	fa, fb := a.GetFingerprint(), b.GetFingerprint()
+	return string(fa[:]) < string(fb[:])
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"dforum-app/configuration"
+	"dforum-app/security"
+	"encoding/json"
+)
+
+// Max number of ancestors updated or walked up from a node
+const maxAncestors = 1024
+
+// Counters of a node maintained as its descendants are stored,
+// avoiding to walk whole subtrees when displaying them.
+type NodeStats struct {
+	Replies      int   // Direct children
+	Descendants  int   // All nodes of the subtree, the node excluded
+	LastActivity int64 // Most recent timestamp of the subtree, the node included
+	// Direct children agreeing or disagreeing with the node, see their indicator
+	Agreeing    int
+	Disagreeing int
+}
+
+// Retrieve the counters of a stored node, empty if the node is unknown
+func (s *StorageModule) GetNodeStats(id security.HashSignature) NodeStats {
+	statsBytes, ok := s.db.GetNodeStats(id)
+	if !ok {
+		return NodeStats{}
+	}
+	var stats NodeStats
+	if err := json.Unmarshal(statsBytes, &stats); err != nil {
+		configuration.Logger.Error("could not parse node stats from bytes")
+		return NodeStats{}
+	}
+	return stats
+}
+
+// Number of ancestors of a node, top level nodes having a depth of 0.
+// Returns false if an ancestor is missing locally.
+func (s *StorageModule) GetDepth(n *Node) (int, bool) {
+	depth := 0
+	for parent := n.DatObj.Parent; parent != (security.HashSignature{}); depth++ {
+		ancestor := s.GetNode(parent, false)
+		if ancestor == nil || depth >= maxAncestors {
+			return depth, false
+		}
+		parent = ancestor.DatObj.Parent
+	}
+	return depth, true
+}
+
+func (s *StorageModule) storeNodeStats(id security.HashSignature, stats NodeStats) {
+	statsBytes, err := json.Marshal(stats)
+	if err != nil {
+		configuration.Logger.Error("could not convert node stats to bytes")
+		return
+	}
+	s.db.StoreNodeStats(id, statsBytes)
+}
+
+// Initialise the counters of a newly stored node and add its subtree to those of its ancestors.
+// Children stored before the node, while it was missing, are counted in its own counters.
+// Called with statsLock held.
+func (s *StorageModule) addToNodeStats(n *Node) {
+	if n.IsVote() {
+		return
+	}
+	stats := NodeStats{LastActivity: n.GetTimestamp()}
+	for _, child := range s.db.GetChildren(n.GetFingerprint()) {
+		if childNode := s.GetNode(child, false); childNode != nil {
+			stats = addChildStats(stats, childNode, s.GetNodeStats(child))
+		}
+	}
+	s.storeNodeStats(n.GetFingerprint(), stats)
+
+	parent := n.DatObj.Parent
+	for i := 0; i < maxAncestors && parent != (security.HashSignature{}); i++ {
+		ancestor := s.GetNode(parent, false)
+		if ancestor == nil {
+			// Counted once the missing ancestor is stored
+			return
+		}
+		ancestorStats := s.GetNodeStats(parent)
+		if i == 0 {
+			ancestorStats = addChildStats(ancestorStats, n, stats)
+		} else {
+			ancestorStats.Descendants += 1 + stats.Descendants
+		}
+		if stats.LastActivity > ancestorStats.LastActivity {
+			ancestorStats.LastActivity = stats.LastActivity
+		}
+		s.storeNodeStats(parent, ancestorStats)
+		parent = ancestor.DatObj.Parent
+	}
+}
+
+// Compute the counters of every node, for databases created before they were maintained
+func (s *StorageModule) rebuildNodeStats() {
+	s.statsLock.Lock()
+	defer s.statsLock.Unlock()
+
+	ids := s.db.GetAllNodeIDs()
+	if len(ids) == 0 {
+		return
+	}
+	configuration.Logger.Infof("computing the stats of %d nodes", len(ids))
+	computed := make(map[security.HashSignature]NodeStats, len(ids))
+	for _, id := range ids {
+		s.computeNodeStats(id, computed, 0)
+	}
+	for id, stats := range computed {
+		s.storeNodeStats(id, stats)
+	}
+}
+
+func (s *StorageModule) computeNodeStats(id security.HashSignature, computed map[security.HashSignature]NodeStats, depth int) NodeStats {
+	if stats, ok := computed[id]; ok {
+		return stats
+	}
+	n, ok := s.db.GetNode(id)
+	if !ok || n == nil {
+		return NodeStats{}
+	}
+	stats := NodeStats{LastActivity: n.GetTimestamp()}
+	if depth < maxAncestors {
+		for _, child := range s.db.GetChildren(id) {
+			if childNode, ok := s.db.GetNode(child); ok && childNode != nil {
+				stats = addChildStats(stats, childNode, s.computeNodeStats(child, computed, depth+1))
+			}
+		}
+	}
+	computed[id] = stats
+	return stats
+}
+
+// Add a direct child and its subtree to the counters of a node
+func addChildStats(stats NodeStats, child *Node, childStats NodeStats) NodeStats {
+	// Votes are not replies, they are counted by TallyPoll
+	if child.IsVote() {
+		return stats
+	}
+	stats.Replies++
+	stats.Descendants += 1 + childStats.Descendants
+	if childStats.LastActivity > stats.LastActivity {
+		stats.LastActivity = childStats.LastActivity
+	}
+	// Indicators range from 0, completely disagreeing, to 10, 5 being neutral
+	switch indicator := child.DatObj.Indicator; {
+	case indicator > 5 && indicator <= 10:
+		stats.Agreeing++
+	case indicator >= 0 && indicator < 5:
+		stats.Disagreeing++
+	}
+	return stats
+}
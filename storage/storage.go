@@ -2,8 +2,10 @@
 package storage
 
 import (
+	"dforum-app/configuration"
 	"dforum-app/security"
-	"math/rand"
+	"encoding/json"
+	"sync"
 	"time"
 )
 
@@ -11,20 +13,64 @@ type NewNodeListener interface {
 	RegisterNewNode(*Node)
 }
 
+// Implemented by listeners that also need to know which nodes were created on this peer
+// rather than received from the network
+type LocalNodeListener interface {
+	RegisterLocalNode(*Node)
+}
+
 type StorageModule struct {
 	cache     StorageCache
 	db        Database
 	listeners []NewNodeListener
+	// Serialises updates of the node stats
+	statsLock sync.Mutex
+	readOnly  bool
+	// Fetches missing attachment chunks from peers, attachments being fetched are kept in fetching
+	fetcher   AttachmentFetcher
+	fetching  map[security.HashSignature]bool
+	fetchLock sync.Mutex
 }
 
 func NewStorageModule(pathToDb string) *StorageModule {
+	s, err := OpenStorageModule(pathToDb)
+	if err != nil {
+		configuration.Logger.Error("could not open the database:", err.Error())
+	}
+	return s
+}
+
+// Open the storage, failing if the database cannot be opened, such as when another process uses it
+func OpenStorageModule(pathToDb string) (*StorageModule, error) {
 	db := NewLevelDbImpl()
-	db.InitDatabase(pathToDb)
+	err := db.InitDatabase(pathToDb)
 
-	return &StorageModule{
-		cache: NewStorageCache(),
-		db:    db,
+	s := &StorageModule{
+		cache:    NewStorageCache(),
+		db:       db,
+		fetching: map[security.HashSignature]bool{},
+	}
+	if err != nil {
+		return s, err
 	}
+	if !db.HasNodeStats() {
+		s.rebuildNodeStats()
+	}
+	return s, nil
+}
+
+// Open the storage of another process, such as a running daemon, without modifying it
+func NewReadOnlyStorageModule(pathToDb string) (*StorageModule, error) {
+	db := NewLevelDbImpl()
+	if err := db.InitReadOnlyDatabase(pathToDb); err != nil {
+		return nil, err
+	}
+	return &StorageModule{
+		cache:    NewStorageCache(),
+		db:       db,
+		readOnly: true,
+		fetching: map[security.HashSignature]bool{},
+	}, nil
 }
 
 /*
@@ -50,13 +96,31 @@ func (s *StorageModule) NodeExists(nodeHash security.HashSignature) bool {
 func (s *StorageModule) StoreAndRegisterNewNode(n *Node) {
 	s.StoreNode(n)
 	s.PublishNode(n)
+	for _, v := range s.listeners {
+		if l, ok := v.(LocalNodeListener); ok {
+			l.RegisterLocalNode(n)
+		}
+	}
 }
 
 // Store a given node in the database
 func (s *StorageModule) StoreNode(n *Node) {
-	// Add the node to the database
-	s.db.StoreNode(n)
+	// Add the node to the database, checking whether it is new under the stats lock
+	// so that a node stored concurrently is only counted once
+	s.statsLock.Lock()
+	isNew := !s.NodeExists(n.GetFingerprint())
+	stored := s.db.StoreNode(n)
+	if stored && isNew {
+		s.addToNodeStats(n)
+	}
+	s.statsLock.Unlock()
 	s.cache.addNode(n)
+	// Track nodes received before their parent, they cannot be reached from a top level node
+	if s.IsOrphan(n) {
+		s.db.StoreOrphan(n.DatObj.Parent, n.GetFingerprint())
+	}
+	// Children waiting for this node are no longer orphans
+	s.db.DeleteOrphans(n.GetFingerprint())
 }
 
 func (s *StorageModule) PublishNode(n *Node) {
@@ -89,6 +153,16 @@ func (s *StorageModule) GetNode(id security.HashSignature, shouldCache bool) *No
 	return nil
 }
 
+// Hashes of every node stored, used to check the database
+func (s *StorageModule) GetAllNodeIDs() []security.HashSignature {
+	return s.db.GetAllNodeIDs()
+}
+
+// Hashes of the direct children of a node, following the parent edges
+func (s *StorageModule) GetChildrenIDs(parent security.HashSignature) []security.HashSignature {
+	return s.db.GetChildren(parent)
+}
+
 func (s *StorageModule) GetTopLevelNodes() []*Node {
 	// Children of a 0 hash are top level nodes
 	nodeSlice := []*Node{}
@@ -110,12 +184,6 @@ func (s *StorageModule) GetChildrenNodes(parent security.HashSignature, includeP
 	fetchedNodes := []*Node{}
 	childrenHashes := s.db.GetChildren(parent)
 
-	// Shuffle children
-	for i := range fetchedNodes {
-		j := rand.Intn(i + 1)
-		fetchedNodes[i], fetchedNodes[j] = fetchedNodes[j], fetchedNodes[i]
-	}
-
 	if includeParent {
 		fetchedNodes = append(fetchedNodes, s.GetNode(parent, false))
 	}
@@ -130,14 +198,138 @@ func (s *StorageModule) GetChildrenNodes(parent security.HashSignature, includeP
 	return fetchedNodes
 }
 
+// Check whether a node's parent is missing locally, making the node an orphan.
+func (s *StorageModule) IsOrphan(n *Node) bool {
+	parent := n.DatObj.Parent
+	return parent != (security.HashSignature{}) && !s.NodeExists(parent)
+}
+
+// Returns the parent hash of a stored node if that parent is not stored locally.
+func (s *StorageModule) GetMissingParent(id security.HashSignature) (security.HashSignature, bool) {
+	node := s.GetNode(id, false)
+	if node == nil || !s.IsOrphan(node) {
+		return security.HashSignature{}, false
+	}
+	return node.DatObj.Parent, true
+}
+
+// Retrieve all nodes whose parent has not been received yet.
+func (s *StorageModule) GetOrphanNodes() []*Node {
+	nodeSlice := []*Node{}
+	for _, id := range s.db.GetOrphans() {
+		if node := s.GetNode(id, false); node != nil {
+			nodeSlice = append(nodeSlice, node)
+		}
+	}
+	return nodeSlice
+}
+
+// Walk up the parents of a node to find the top level node of its discussion.
+// Returns false if an ancestor is missing locally.
+func (s *StorageModule) GetTopLevelAncestor(n *Node) (security.HashSignature, bool) {
+	current := n
+	for current.DatObj.Parent != (security.HashSignature{}) {
+		current = s.GetNode(current.DatObj.Parent, false)
+		if current == nil {
+			return security.HashSignature{}, false
+		}
+	}
+	return current.GetFingerprint(), true
+}
+
 func (s *StorageModule) GetNodesSince(t time.Time) []security.HashSignature {
 	return s.db.GetAllNodesSince(t)
 }
 
+// Visit nodes from the most recent one until visit returns false, without loading every ID at once
+func (s *StorageModule) WalkNodesNewestFirst(visit func(security.HashSignature) bool) {
+	s.db.WalkNodesNewestFirst(visit)
+}
+
 func (s *StorageModule) TimeOfMostRecentNode() time.Time {
 	return s.db.TimeOfMostRecentNode()
 }
 
+// Persist a node hash that peers have announced but that is not stored locally yet,
+// along with the peers known to have it, so that it can be fetched after a restart.
+func (s *StorageModule) StoreWant(id security.HashSignature, peers []string) {
+	peerBytes, err := json.Marshal(peers)
+	if err != nil {
+		configuration.Logger.Error("could not convert want peers to bytes")
+		return
+	}
+	s.db.StoreWant(id, peerBytes)
+}
+
+func (s *StorageModule) DeleteWant(id security.HashSignature) {
+	s.db.DeleteWant(id)
+}
+
+// Retrieve all persisted wants and the peers known to have them.
+func (s *StorageModule) GetWants() map[security.HashSignature][]string {
+	wants := make(map[security.HashSignature][]string)
+	for id, peerBytes := range s.db.GetAllWants() {
+		var peers []string
+		if err := json.Unmarshal(peerBytes, &peers); err != nil {
+			configuration.Logger.Error("could not parse want peers from bytes")
+			continue
+		}
+		wants[id] = peers
+	}
+	return wants
+}
+
+// Persist the ban of a misbehaving peer until a given time
+func (s *StorageModule) StoreBan(peer string, until time.Time) {
+	s.db.StoreBan(peer, until)
+}
+
+func (s *StorageModule) DeleteBan(peer string) {
+	s.db.DeleteBan(peer)
+}
+
+func (s *StorageModule) GetBans() map[string]time.Time {
+	return s.db.GetAllBans()
+}
+
+// Entry of the address book, recording how to reach a peer and how reliable it was
+type PeerRecord struct {
+	Addrs               []string
+	Protocols           []string
+	LastSeen            time.Time
+	LastAttempt         time.Time
+	Successes           int
+	Failures            int
+	ConsecutiveFailures int
+}
+
+func (s *StorageModule) StorePeerRecord(peer string, record PeerRecord) {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		configuration.Logger.Error("could not convert peer record to bytes")
+		return
+	}
+	s.db.StorePeerRecord(peer, recordBytes)
+}
+
+func (s *StorageModule) DeletePeerRecord(peer string) {
+	s.db.DeletePeerRecord(peer)
+}
+
+// Retrieve the address book indexed by peer ID
+func (s *StorageModule) GetPeerRecords() map[string]PeerRecord {
+	records := make(map[string]PeerRecord)
+	for peer, recordBytes := range s.db.GetAllPeerRecords() {
+		var record PeerRecord
+		if err := json.Unmarshal(recordBytes, &record); err != nil {
+			configuration.Logger.Error("could not parse peer record from bytes")
+			continue
+		}
+		records[peer] = record
+	}
+	return records
+}
+
 func (s *StorageModule) TearDown() {
 	// Close Database
 	s.db.Close()
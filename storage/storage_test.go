@@ -1,10 +1,17 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"dforum-app/security"
 	"fmt"
 	"log"
+	"os"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/spf13/viper"
 )
 
 func TestNodeStorage(*testing.T) {
@@ -37,3 +44,357 @@ func TestParentRelation(*testing.T) {
 		log.Println(v)
 	}
 }
+
+func TestGetNodesSince(t *testing.T) {
+	previous := viper.Get("security.proofofwork-level")
+	viper.Set("security.proofofwork-level", 16)
+	t.Cleanup(func() { viper.Set("security.proofofwork-level", previous) })
+	os.RemoveAll("../test/since/")
+	sut := NewStorageModule("../test/since/")
+	defer sut.TearDown()
+
+	node := NewNode("Recent", "", 5, [28]byte{})
+	sut.StoreNode(node)
+	if ids := sut.GetNodesSince(time.Now().Add(-time.Minute)); len(ids) != 1 || ids[0] != node.GetFingerprint() {
+		t.Fatal("nodes stored in the current second should be listed:", ids)
+	}
+}
+
+func TestOrphanTracking(t *testing.T) {
+	os.RemoveAll("../test/orphans/")
+	sut := NewStorageModule("../test/orphans/")
+	defer sut.TearDown()
+
+	parent := newUnverifiedNode(1, [28]byte{})
+	child := newUnverifiedNode(2, parent.GetFingerprint())
+	sut.StoreNode(child)
+
+	if missing, ok := sut.GetMissingParent(child.GetFingerprint()); !ok || missing != parent.GetFingerprint() {
+		t.Fatal("expected the parent of the child to be missing")
+	}
+	if len(sut.GetOrphanNodes()) != 1 {
+		t.Fatal("expected the child to be tracked as an orphan")
+	}
+
+	sut.StoreNode(parent)
+	if _, ok := sut.GetMissingParent(child.GetFingerprint()); ok {
+		t.Fatal("expected the parent to be found")
+	}
+	if len(sut.GetOrphanNodes()) != 0 {
+		t.Fatal("expected the orphan to be cleared once its parent is stored")
+	}
+}
+
+// Create a node without proof of work, fingerprints are derived from the id
+func newUnverifiedNode(id byte, parent [28]byte) *Node {
+	return &Node{
+		DatObj: DataObject{Parent: parent, Timestamp: time.Now().Unix(), Topic: "Topic", Indicator: 5},
+		SecObj: security.SecurityObject{Fingerprint: [28]byte{id}},
+	}
+}
+
+func TestNodeStats(t *testing.T) {
+	path := "../test/stats/"
+	os.RemoveAll(path)
+	sut := NewStorageModule(path)
+
+	topic := newUnverifiedNode(1, [28]byte{})
+	reply := newUnverifiedNode(2, topic.GetFingerprint())
+	nested := newUnverifiedNode(3, reply.GetFingerprint())
+	nested.DatObj.Timestamp += 60
+	other := newUnverifiedNode(4, topic.GetFingerprint())
+	// The nested reply is received before its parent
+	for _, n := range []*Node{topic, nested, reply, other, other} {
+		sut.StoreNode(n)
+	}
+
+	expected := NodeStats{Replies: 2, Descendants: 3, LastActivity: nested.GetTimestamp()}
+	if stats := sut.GetNodeStats(topic.GetFingerprint()); stats != expected {
+		t.Fatal("unexpected topic stats:", stats)
+	}
+	if stats := sut.GetNodeStats(reply.GetFingerprint()); stats.Replies != 1 || stats.Descendants != 1 {
+		t.Fatal("unexpected reply stats:", stats)
+	}
+	if depth, ok := sut.GetDepth(nested); !ok || depth != 2 {
+		t.Fatal("unexpected depth:", depth)
+	}
+	// A node received from several peers at once is counted once
+	concurrent := newUnverifiedNode(5, other.GetFingerprint())
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sut.StoreNode(concurrent)
+		}()
+	}
+	wg.Wait()
+	if stats := sut.GetNodeStats(other.GetFingerprint()); stats.Replies != 1 {
+		t.Fatal("concurrently stored node counted more than once:", stats)
+	}
+	expected.Descendants++
+
+	// Stats are computed for databases created before they were maintained
+	sut.TearDown()
+	os.RemoveAll(path + "datastats.db")
+	sut = NewStorageModule(path)
+	defer sut.TearDown()
+	if stats := sut.GetNodeStats(topic.GetFingerprint()); stats != expected {
+		t.Fatal("unexpected rebuilt topic stats:", stats)
+	}
+}
+
+func TestSortNodes(t *testing.T) {
+	path := "../test/order/"
+	os.RemoveAll(path)
+	sut := NewStorageModule(path)
+	defer sut.TearDown()
+
+	topic := newUnverifiedNode(1, [28]byte{})
+	agreed := newUnverifiedNode(2, topic.GetFingerprint())
+	contested := newUnverifiedNode(3, topic.GetFingerprint())
+	quiet := newUnverifiedNode(4, topic.GetFingerprint())
+	quiet.DatObj.Timestamp += 60
+	replies := []*Node{topic, agreed, contested, quiet}
+	for i, indicator := range []int8{9, 8, 1, 10, 0, 2} {
+		parent := agreed
+		if i >= 2 {
+			parent = contested
+		}
+		reply := newUnverifiedNode(byte(10+i), parent.GetFingerprint())
+		reply.DatObj.Indicator = indicator
+		replies = append(replies, reply)
+	}
+	for _, n := range replies {
+		sut.StoreNode(n)
+	}
+
+	expected := map[SortOrder][]*Node{
+		OrderNewest:    {quiet, agreed, contested},
+		OrderOldest:    {agreed, contested, quiet},
+		OrderActive:    {contested, agreed, quiet},
+		OrderAgreed:    {agreed, quiet, contested},
+		OrderContested: {contested, agreed, quiet},
+	}
+	for order, nodes := range expected {
+		sorted := sut.GetSortedChildrenNodes(topic.GetFingerprint(), order, 0, 0)
+		if len(sorted) != len(nodes) {
+			t.Fatal("unexpected number of children:", len(sorted))
+		}
+		for i := range nodes {
+			if sorted[i].GetFingerprint() != nodes[i].GetFingerprint() {
+				t.Fatalf("unexpected %s order at %d: %s", order, i, sorted[i].DatObj.Topic)
+			}
+		}
+	}
+
+	first := sut.GetSortedChildrenNodes(topic.GetFingerprint(), OrderRandom, 42, 0)
+	second := sut.GetSortedChildrenNodes(topic.GetFingerprint(), OrderRandom, 42, 0)
+	for i := range first {
+		if first[i].GetFingerprint() != second[i].GetFingerprint() {
+			t.Fatal("the random order should be stable for a given seed")
+		}
+	}
+	if len(sut.GetSortedChildrenNodes(topic.GetFingerprint(), OrderRandom, 42, 2)) != 2 {
+		t.Fatal("children should be limited")
+	}
+}
+
+func TestGetThread(t *testing.T) {
+	path := "../test/thread/"
+	os.RemoveAll(path)
+	sut := NewStorageModule(path)
+	defer sut.TearDown()
+
+	// A chain of 4 nodes below the topic and a second reply to the topic
+	topic := newUnverifiedNode(1, [28]byte{})
+	sut.StoreNode(topic)
+	parent := topic
+	for i := byte(2); i <= 5; i++ {
+		n := newUnverifiedNode(i, parent.GetFingerprint())
+		sut.StoreNode(n)
+		parent = n
+	}
+	sut.StoreNode(newUnverifiedNode(6, topic.GetFingerprint()))
+
+	thread := sut.GetThread(topic.GetFingerprint(), 10, 100, OrderOldest, 0)
+	if len(thread.Nodes) != 6 || thread.Truncated || thread.Nodes[0].Node.GetFingerprint() != topic.GetFingerprint() {
+		t.Fatal("expected the whole thread:", len(thread.Nodes))
+	}
+	for _, n := range thread.Nodes[1:] {
+		if n.Depth < 1 || n.Depth > 4 {
+			t.Fatal("unexpected depth:", n.Depth)
+		}
+	}
+
+	if thread := sut.GetThread(topic.GetFingerprint(), 2, 100, OrderOldest, 0); len(thread.Nodes) != 4 || !thread.Truncated {
+		t.Fatal("expected the thread to be limited to 2 levels:", len(thread.Nodes))
+	}
+	if thread := sut.GetThread(topic.GetFingerprint(), 10, 3, OrderOldest, 0); len(thread.Nodes) != 3 || !thread.Truncated {
+		t.Fatal("expected the thread to be limited to 3 nodes:", len(thread.Nodes))
+	}
+	if thread := sut.GetThread([28]byte{9}, 10, 100, OrderOldest, 0); len(thread.Nodes) != 0 {
+		t.Fatal("unknown roots should return an empty thread")
+	}
+}
+
+func TestArchive(t *testing.T) {
+	previous := viper.Get("security.proofofwork-level")
+	viper.Set("security.proofofwork-level", 16)
+	t.Cleanup(func() { viper.Set("security.proofofwork-level", previous) })
+	os.RemoveAll("../test/archive/")
+	source := NewStorageModule("../test/archive/source/")
+	defer source.TearDown()
+
+	topic := NewNode("Topic", "detail", -1, [28]byte{})
+	reply := NewNode("Reply", "content", 7, topic.GetFingerprint())
+	other := NewNode("Other", "detail", -1, [28]byte{})
+	tampered := NewNode("Tampered", "content", 3, topic.GetFingerprint())
+	tampered.DatObj.Content = "changed"
+	for _, n := range []*Node{reply, topic, other, tampered} {
+		source.StoreNode(n)
+	}
+
+	archive := &bytes.Buffer{}
+	if count, err := source.ExportArchive(archive, nil); err != nil || count != 4 {
+		t.Fatal("failed to export every node:", count, err)
+	}
+	destination := NewStorageModule("../test/archive/destination/")
+	defer destination.TearDown()
+	report, err := destination.ImportArchive(bytes.NewReader(archive.Bytes()))
+	if err != nil || report != (ImportReport{Imported: 3, Invalid: 1}) {
+		t.Fatal("unexpected import:", report, err)
+	}
+	if !destination.NodeExists(reply.GetFingerprint()) || destination.NodeExists(tampered.GetFingerprint()) {
+		t.Fatal("only verified nodes should be stored")
+	}
+	if stats := destination.GetNodeStats(topic.GetFingerprint()); stats.Replies != 1 {
+		t.Fatal("unexpected stats of imported nodes:", stats)
+	}
+
+	subtree := &bytes.Buffer{}
+	root := security.HashSignature(topic.GetFingerprint())
+	if count, _ := source.ExportArchive(subtree, &root); count != 3 {
+		t.Fatal("expected the topic and its replies, got", count)
+	}
+	if report, _ := destination.ImportArchive(subtree); report.Existing != 2 || report.Imported != 0 {
+		t.Fatal("stored nodes should not be imported again:", report)
+	}
+	if _, err := destination.ImportArchive(bytes.NewReader([]byte("{}\n"))); err != ErrInvalidArchive {
+		t.Fatal("invalid archives should be refused")
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	previous := viper.Get("security.proofofwork-level")
+	viper.Set("security.proofofwork-level", 16)
+	t.Cleanup(func() { viper.Set("security.proofofwork-level", previous) })
+	os.RemoveAll("../test/attachments/")
+	sut := NewStorageModule("../test/attachments/")
+	defer sut.TearDown()
+
+	content := bytes.Repeat([]byte("attachment"), AttachmentChunkSize/4)
+	a, err := NewAttachment("file.txt", "text/plain", content)
+	if err != nil || len(a.Chunks) != 3 || a.ChunkSize(2) != len(content)-2*AttachmentChunkSize {
+		t.Fatal("unexpected attachment:", len(a.Chunks), err)
+	}
+	node := NewNodeWithAttachments("Files", "", -1, [28]byte{}, []Attachment{a})
+	if node == nil || !node.Verify() || !node.SecObj.HasWork(node.DatObj.GetBytes(), 18) {
+		t.Fatal("nodes with attachments should need more work than other nodes")
+	}
+	lowWork := *node
+	lowWork.SecObj, _ = security.GenSecurityObject(lowWork.DatObj.GetBytes())
+	if lowWork.Verify() {
+		t.Fatal("nodes with attachments and the work of other nodes should be rejected")
+	}
+	large := Attachment{Hash: a.Hash, Name: "large.bin", Size: 17 * AttachmentChunkSize, Chunks: make([]security.HashSignature, 17)}
+	if RequiredDifficulty([]Attachment{a}, 16) != 18 || RequiredDifficulty([]Attachment{large}, 16) != 19 {
+		t.Fatal("work should grow by a bit each time attachments grow 4 times")
+	}
+	if RequiredDifficulty([]Attachment{large}, 24) != 27 || RequiredDifficulty([]Attachment{large}, 28) != security.MaxDifficulty {
+		t.Fatal("work should not grow above the highest difficulty")
+	}
+	if plain := NewNode("Plain", "", -1, [28]byte{}); bytes.Contains(plain.DatObj.GetBytes(), []byte("Attachments")) {
+		t.Fatal("nodes without attachments should keep their format")
+	}
+
+	if err := sut.StoreChunk(a, 1, content[:AttachmentChunkSize]); err != ErrInvalidChunk {
+		t.Fatal("chunks should be checked against their hash")
+	}
+	if err := sut.StoreChunk(a, 1, content[AttachmentChunkSize:2*AttachmentChunkSize]); err != nil || sut.StoredChunks(a) != 1 {
+		t.Fatal("failed to store a chunk:", err)
+	}
+	if _, err := sut.GetAttachmentContent(a); err != ErrAttachmentIncomplete {
+		t.Fatal("incomplete attachments should not be read")
+	}
+	if err := sut.FetchAttachment(a, func(int, int) {}); err != ErrAttachmentNoPeer {
+		t.Fatal("missing chunks cannot be fetched without peers:", err)
+	}
+	if err := sut.StoreAttachment(a, content); err != nil || sut.StoredChunks(a) != 3 {
+		t.Fatal("failed to store the attachment:", err)
+	}
+	if stored, err := sut.GetAttachmentContent(a); err != nil || !bytes.Equal(stored, content) {
+		t.Fatal("failed to read the attachment:", err)
+	}
+}
+
+func TestPolls(t *testing.T) {
+	previous := viper.Get("security.proofofwork-level")
+	viper.Set("security.proofofwork-level", 16)
+	t.Cleanup(func() { viper.Set("security.proofofwork-level", previous) })
+	os.RemoveAll("../test/polls/")
+	sut := NewStorageModule("../test/polls/")
+	defer sut.TearDown()
+
+	if NewPollNode("Poll", "", -1, [28]byte{}, Poll{Options: []string{"Only"}}) != nil {
+		t.Fatal("polls need at least two options")
+	}
+	poll := NewPollNode("Lunch?", "Pick one", -1, [28]byte{}, Poll{Options: []string{"Pizza", "Salad", "Soup"}})
+	if poll == nil || !poll.Verify() || !poll.IsPoll() {
+		t.Fatal("failed to create a poll")
+	}
+	sut.StoreNode(poll)
+	id := poll.GetFingerprint()
+	alice, bob := []byte("alice"), []byte("bob")
+	// The latest vote of a voter replaces the previous ones
+	votes := []*Node{newVoteNode(id, 0, alice, poll.GetTimestamp()), newVoteNode(id, 1, alice, poll.GetTimestamp()+1), NewVoteNode(id, 1, bob), NewVoteNode(id, 7, []byte("carol"))}
+	for _, v := range votes {
+		if !v.Verify() {
+			t.Fatal("votes should be verified")
+		}
+		sut.StoreNode(v)
+	}
+	// Votes of a voter cannot be changed by anyone else
+	hijack := newVoteNode(id, 0, []byte("mallory"), poll.GetTimestamp()+2)
+	hijack.DatObj.Vote.Voter = VoterID(alice, id)
+	hijack.SecObj, _ = security.GenSecurityObject(hijack.DatObj.GetBytes())
+	if hijack.Verify() {
+		t.Fatal("votes should be signed by their voter")
+	}
+	reply := NewNode("Salad again?", "", 3, id)
+	sut.StoreNode(reply)
+
+	results, err := sut.TallyPoll(id)
+	if err != nil || results.Votes != 2 || results.Counts[1] != 2 || results.Duplicates != 1 || results.Invalid != 1 {
+		t.Fatal("unexpected results:", results, err)
+	}
+	if option, ok := sut.GetVoterChoice(id, VoterID(alice, id)); !ok || option != 1 {
+		t.Fatal("the latest vote of a voter should be its choice")
+	}
+	if _, err := sut.TallyPoll(reply.GetFingerprint()); err != ErrNotAPoll {
+		t.Fatal("only polls can be tallied")
+	}
+	if stats := sut.GetNodeStats(id); stats.Replies != 1 || stats.Descendants != 1 {
+		t.Fatal("votes should not be counted as replies:", stats)
+	}
+	if thread := sut.GetThread(id, 2, 10, OrderOldest, 0); len(thread.Nodes) != 2 {
+		t.Fatal("votes should not be listed in threads:", len(thread.Nodes))
+	}
+
+	closed := *poll
+	closed.DatObj.Poll = &Poll{Options: poll.DatObj.Poll.Options, Closes: poll.GetTimestamp()}
+	late := newVoteNode(id, 0, bob, poll.GetTimestamp()+10)
+	if results := tallyVotes(&closed, []*Node{late}, time.Unix(poll.GetTimestamp()+20, 0)); !results.Closed || results.Invalid != 1 {
+		t.Fatal("votes after a poll closed should not be counted:", results)
+	}
+}
@@ -0,0 +1,55 @@
+package storage
+
+import "dforum-app/security"
+
+// Node of a thread with its distance to the root of the thread
+type ThreadNode struct {
+	Node  *Node
+	Depth int
+}
+
+type Thread struct {
+	// The root first, then breadth first with siblings in the requested order
+	Nodes []ThreadNode
+	// Set when nodes were left out by the depth or node limits
+	Truncated bool
+}
+
+// Fetch the subtree of a node following the edge index, votes excluded, up to maxDepth levels
+// below the root and at most maxNodes nodes, the root included.
+// Returns an empty thread if the root is not stored.
+func (s *StorageModule) GetThread(root security.HashSignature, maxDepth int, maxNodes int, order SortOrder, seed uint64) Thread {
+	thread := Thread{Nodes: []ThreadNode{}}
+	rootNode := s.GetNode(root, false)
+	if rootNode == nil || maxNodes <= 0 {
+		return thread
+	}
+	thread.Nodes = append(thread.Nodes, ThreadNode{Node: rootNode})
+	// Fetch the children of the nodes in the order they were added, breadth first
+	for next := 0; next < len(thread.Nodes); next++ {
+		parent := thread.Nodes[next]
+		childrenIDs := s.db.GetChildren(parent.Node.GetFingerprint())
+		if len(childrenIDs) == 0 {
+			continue
+		}
+		if parent.Depth >= maxDepth {
+			thread.Truncated = true
+			continue
+		}
+		children := []*Node{}
+		for _, id := range childrenIDs {
+			if n := s.GetNode(id, false); n != nil && !n.IsVote() {
+				children = append(children, n)
+			}
+		}
+		s.SortNodes(children, order, seed)
+		for _, n := range children {
+			if len(thread.Nodes) >= maxNodes {
+				thread.Truncated = true
+				return thread
+			}
+			thread.Nodes = append(thread.Nodes, ThreadNode{Node: n, Depth: parent.Depth + 1})
+		}
+	}
+	return thread
+}
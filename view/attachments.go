@@ -0,0 +1,227 @@
+package view
+
+import (
+	"bytes"
+	"dforum-app/configuration"
+	"dforum-app/storage"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
+
+	// Formats thumbnails can be made of
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+const (
+	// Max width and height of thumbnails
+	thumbnailSize = 160
+	// Larger images are not decoded, they take 4 bytes per pixel once decoded.
+	// The resolution of common phone cameras, 12 megapixels.
+	maxThumbnailPixels = 4096 * 3072
+)
+
+var errUnknownAttachment = errors.New("unknown attachment")
+
+type GuiAttachment struct {
+	Hash      string
+	Name      string
+	MediaType string
+	Size      int64
+	// Number of chunks and of chunks stored locally, the attachment can be opened once all are stored
+	Chunks int
+	Stored int
+}
+
+// File picked on the GUI, its content base64 encoded
+type GuiUpload struct {
+	Name      string
+	MediaType string
+	Data      string
+}
+
+// Pushed as an attachment_post_done event once the proof of work of a post with attachments is done
+type GuiPostDone struct {
+	ID    string
+	Error string
+}
+
+// Pushed as attachment_progress events while an attachment is downloaded
+type GuiDownloadProgress struct {
+	Hash   string
+	Stored int
+	Total  int
+	Done   bool
+	Error  string // Set if the download stopped before all chunks were stored
+}
+
+// Create a node with files attached, their content is stored locally and served to peers on request.
+// The proof of work of larger posts can take minutes, it runs in the background and an
+// attachment_post_done event carrying the ID chosen by the GUI is pushed once the node is stored.
+func (vh *ViewHandler) CreateNodeWithAttachments(id string, topic string, detail string, indicator int, parent string, uploads []GuiUpload) error {
+	if len(uploads) > storage.MaxAttachments {
+		return errors.New("too many attachments")
+	}
+	attachments := []storage.Attachment{}
+	contents := [][]byte{}
+	for _, u := range uploads {
+		content, err := base64.StdEncoding.DecodeString(u.Data)
+		if err != nil {
+			return err
+		}
+		a, err := storage.NewAttachment(u.Name, u.MediaType, content)
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, a)
+		contents = append(contents, content)
+	}
+	for i, a := range attachments {
+		if err := vh.storageModule.StoreAttachment(a, contents[i]); err != nil {
+			return err
+		}
+	}
+	go func() {
+		done := GuiPostDone{ID: id}
+		newNode := storage.NewNodeWithAttachments(topic, detail, int8(indicator), hashFromBase64(parent), attachments)
+		if newNode == nil {
+			done.Error = "could not create the node"
+		} else {
+			vh.storageModule.StoreAndRegisterNewNode(newNode)
+		}
+		if vh.wailsRuntime != nil {
+			vh.wailsRuntime.Events.Emit("attachment_post_done", done)
+		}
+	}()
+	return nil
+}
+
+// Start fetching the missing chunks of an attachment from peers,
+// its progress is pushed to the GUI as attachment_progress events
+func (vh *ViewHandler) DownloadAttachment(nodeId string, hash string) error {
+	a, err := vh.getAttachment(nodeId, hash)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := vh.storageModule.FetchAttachment(a, func(stored int, total int) {
+			vh.emitProgress(GuiDownloadProgress{Hash: hash, Stored: stored, Total: total})
+		})
+		if err == storage.ErrAttachmentFetching {
+			return
+		}
+		progress := GuiDownloadProgress{Hash: hash, Stored: vh.storageModule.StoredChunks(a), Total: len(a.Chunks), Done: true}
+		if err != nil {
+			configuration.Logger.Info("could not fetch attachment: ", err.Error())
+			progress.Error = err.Error()
+		}
+		vh.emitProgress(progress)
+	}()
+	return nil
+}
+
+// Content of a fully stored attachment, base64 encoded
+func (vh *ViewHandler) GetAttachment(nodeId string, hash string) (string, error) {
+	a, err := vh.getAttachment(nodeId, hash)
+	if err != nil {
+		return "", err
+	}
+	content, err := vh.storageModule.GetAttachmentContent(a)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(content), nil
+}
+
+// Thumbnail of a fully stored image attachment as a PNG data URL.
+// Images are decoded and encoded again so that only plain pixels reach the GUI.
+func (vh *ViewHandler) GetThumbnail(nodeId string, hash string) (string, error) {
+	a, err := vh.getAttachment(nodeId, hash)
+	if err != nil {
+		return "", err
+	}
+	content, err := vh.storageModule.GetAttachmentContent(a)
+	if err != nil {
+		return "", err
+	}
+	return makeThumbnail(content)
+}
+
+func (vh *ViewHandler) getAttachment(nodeId string, hash string) (storage.Attachment, error) {
+	node := vh.storageModule.GetNode(hashFromBase64(nodeId), false)
+	if node == nil {
+		return storage.Attachment{}, errUnknownAttachment
+	}
+	a, ok := node.GetAttachment(hashFromBase64(hash))
+	if !ok {
+		return storage.Attachment{}, errUnknownAttachment
+	}
+	return a, nil
+}
+
+func (vh *ViewHandler) convertAttachments(node *storage.Node) []GuiAttachment {
+	attachments := []GuiAttachment{}
+	for _, a := range node.DatObj.Attachments {
+		attachments = append(attachments, GuiAttachment{
+			Hash:      base64.URLEncoding.EncodeToString(a.Hash[:]),
+			Name:      a.Name,
+			MediaType: a.MediaType,
+			Size:      a.Size,
+			Chunks:    len(a.Chunks),
+			Stored:    vh.storageModule.StoredChunks(a),
+		})
+	}
+	return attachments
+}
+
+func (vh *ViewHandler) emitProgress(progress GuiDownloadProgress) {
+	if vh.wailsRuntime != nil {
+		vh.wailsRuntime.Events.Emit("attachment_progress", progress)
+	}
+}
+
+func makeThumbnail(content []byte) (string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return "", errors.New("image too large for a thumbnail")
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	thumbnail := &bytes.Buffer{}
+	if err := png.Encode(thumbnail, scaleDown(img, thumbnailSize)); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(thumbnail.Bytes()), nil
+}
+
+// Nearest neighbour scaling keeping the aspect ratio, smaller images are kept as they are
+func scaleDown(img image.Image, max int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= max && h <= max {
+		return img
+	}
+	tw, th := max, h*max/w
+	if h > w {
+		tw, th = w*max/h, max
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			scaled.Set(x, y, img.At(bounds.Min.X+x*w/tw, bounds.Min.Y+y*h/th))
+		}
+	}
+	return scaled
+}
@@ -0,0 +1,34 @@
+package view
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestMakeThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 320))
+	content := &bytes.Buffer{}
+	png.Encode(content, img)
+
+	thumbnail, err := makeThumbnail(content.Bytes())
+	if err != nil || !strings.HasPrefix(thumbnail, "data:image/png;base64,") {
+		t.Fatal("failed to make a thumbnail:", err)
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(thumbnail, "data:image/png;base64,"))
+	config, err := png.DecodeConfig(bytes.NewReader(decoded))
+	if err != nil || config.Width != thumbnailSize || config.Height != thumbnailSize/2 {
+		t.Fatal("unexpected thumbnail size:", config.Width, config.Height, err)
+	}
+	if _, err := makeThumbnail([]byte("<svg onload=alert(1)>")); err == nil {
+		t.Fatal("only images should have thumbnails")
+	}
+	content.Reset()
+	png.Encode(content, image.NewGray(image.Rect(0, 0, 4096, 3073)))
+	if _, err := makeThumbnail(content.Bytes()); err == nil {
+		t.Fatal("images above the pixel limit should not be decoded")
+	}
+}
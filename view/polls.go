@@ -0,0 +1,109 @@
+package view
+
+import (
+	"crypto/rand"
+	"dforum-app/configuration"
+	"dforum-app/security"
+	"dforum-app/storage"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+type GuiPollResults struct {
+	PollID     string
+	Options    []string
+	Counts     []int
+	Votes      int
+	Duplicates int // Votes replaced by a later vote of the same voter
+	Invalid    int // Votes not counted
+	Closes     int64
+	Closed     bool
+	// Option of the latest local vote, -1 before voting
+	MyVote int
+}
+
+// Create a poll, as a topic when parent is empty. Polls have no opinion on their parent.
+// Votes are not counted after closes, a unix time, unless it is 0.
+func (vh *ViewHandler) CreatePoll(topic string, detail string, parent string, options []string, closes int64) error {
+	poll := storage.NewPollNode(topic, detail, -1, hashFromBase64(parent), storage.Poll{Options: options, Closes: closes})
+	if poll == nil {
+		return storage.ErrInvalidPoll
+	}
+	vh.storageModule.StoreAndRegisterNewNode(poll)
+	return nil
+}
+
+// Vote for an option of a poll, replacing any previous vote
+func (vh *ViewHandler) Vote(pollId string, option int) error {
+	id := hashFromBase64(pollId)
+	poll := vh.storageModule.GetNode(id, false)
+	if poll == nil || !poll.IsPoll() {
+		return storage.ErrNotAPoll
+	}
+	if option < 0 || option >= len(poll.DatObj.Poll.Options) {
+		return errors.New("unknown poll option")
+	}
+	results, _ := vh.storageModule.TallyPoll(id)
+	if results.Closed {
+		return errors.New("the poll is closed")
+	}
+	vote := storage.NewVoteNode(id, option, vh.voterSecret())
+	if vote == nil {
+		return errors.New("could not create the vote")
+	}
+	vh.storageModule.StoreAndRegisterNewNode(vote)
+	return nil
+}
+
+func (vh *ViewHandler) GetPollResults(pollId string) (GuiPollResults, error) {
+	id := hashFromBase64(pollId)
+	results, err := vh.storageModule.TallyPoll(id)
+	if err != nil {
+		return GuiPollResults{}, err
+	}
+	poll := vh.storageModule.GetNode(id, false)
+	guiResults := GuiPollResults{
+		PollID:     pollId,
+		Options:    results.Options,
+		Counts:     results.Counts,
+		Votes:      results.Votes,
+		Duplicates: results.Duplicates,
+		Invalid:    results.Invalid,
+		Closes:     poll.DatObj.Poll.Closes,
+		Closed:     results.Closed,
+		MyVote:     -1,
+	}
+	if configuration.GetVoterSecret() != "" {
+		if option, ok := vh.storageModule.GetVoterChoice(id, storage.VoterID(vh.voterSecret(), id)); ok {
+			guiResults.MyVote = option
+		}
+	}
+	return guiResults, nil
+}
+
+// Push the new results of a poll subscribed to as a poll_updated event
+func (vh *ViewHandler) registerNewVote(vote *storage.Node) {
+	getNode := func(id security.HashSignature) *storage.Node {
+		return vh.storageModule.GetNode(id, false)
+	}
+	if vh.wailsRuntime == nil || !vh.subscriptions.matches(vote, getNode) {
+		return
+	}
+	results, err := vh.GetPollResults(base64.URLEncoding.EncodeToString(vote.DatObj.Parent[:]))
+	if err == nil {
+		vh.wailsRuntime.Events.Emit("poll_updated", results)
+	}
+}
+
+// Secret the voter keys of polls are derived from, created on the first vote
+func (vh *ViewHandler) voterSecret() []byte {
+	secret := configuration.GetVoterSecret()
+	if secret == "" {
+		secretBytes := make([]byte, 32)
+		rand.Read(secretBytes)
+		secret = hex.EncodeToString(secretBytes)
+		configuration.SetVoterSecret(secret)
+	}
+	return []byte(secret)
+}
@@ -0,0 +1,134 @@
+package view
+
+import (
+	"dforum-app/security"
+	"dforum-app/storage"
+	"sync"
+	"time"
+)
+
+const (
+	// Max number of ancestors walked up to match a subtree subscription
+	maxSubtreeDepth = 256
+	// Delay gathering new nodes before they are sent to the GUI together
+	batchInterval = 200 * time.Millisecond
+	// Batches are sent right away once this size is reached
+	maxBatchSize = 100
+)
+
+// Nodes opened on the GUI whose new descendants must be pushed to it.
+// Subscriptions are explicit and removed when the GUI navigates away.
+type subscriptionRegistry struct {
+	sync.RWMutex
+	parents  map[security.HashSignature]struct{} // Direct children are pushed
+	subtrees map[security.HashSignature]struct{} // Any descendant is pushed
+}
+
+func newSubscriptionRegistry() *subscriptionRegistry {
+	return &subscriptionRegistry{
+		parents:  make(map[security.HashSignature]struct{}),
+		subtrees: make(map[security.HashSignature]struct{}),
+	}
+}
+
+func (r *subscriptionRegistry) subscribe(id security.HashSignature, subtree bool) {
+	r.Lock()
+	defer r.Unlock()
+	if subtree {
+		r.subtrees[id] = struct{}{}
+	} else {
+		r.parents[id] = struct{}{}
+	}
+}
+
+func (r *subscriptionRegistry) unsubscribe(id security.HashSignature, subtree bool) {
+	r.Lock()
+	defer r.Unlock()
+	if subtree {
+		delete(r.subtrees, id)
+	} else {
+		delete(r.parents, id)
+	}
+}
+
+func (r *subscriptionRegistry) clear() {
+	r.Lock()
+	defer r.Unlock()
+	r.parents = make(map[security.HashSignature]struct{})
+	r.subtrees = make(map[security.HashSignature]struct{})
+}
+
+// Check whether a node belongs to a subscribed thread,
+// the ancestors of the node being looked up with getNode.
+func (r *subscriptionRegistry) matches(n *storage.Node, getNode func(security.HashSignature) *storage.Node) bool {
+	r.RLock()
+	defer r.RUnlock()
+	parent := n.DatObj.Parent
+	if _, ok := r.parents[parent]; ok {
+		return true
+	}
+	if len(r.subtrees) == 0 {
+		return false
+	}
+	for i := 0; i < maxSubtreeDepth && parent != (security.HashSignature{}); i++ {
+		if _, ok := r.subtrees[parent]; ok {
+			return true
+		}
+		ancestor := getNode(parent)
+		if ancestor == nil {
+			return false
+		}
+		parent = ancestor.DatObj.Parent
+	}
+	return false
+}
+
+// Gathers nodes per event so that bursts of nodes, such as during a sync,
+// are sent to the GUI in a few events instead of one event per node.
+type eventBatcher struct {
+	sync.Mutex
+	pending  map[string][]GuiNode
+	order    []string // Events in the order they were first added
+	interval time.Duration
+	timer    *time.Timer
+	emit     func(event string, nodes []GuiNode)
+}
+
+func newEventBatcher(interval time.Duration, emit func(event string, nodes []GuiNode)) *eventBatcher {
+	return &eventBatcher{
+		pending:  make(map[string][]GuiNode),
+		interval: interval,
+		emit:     emit,
+	}
+}
+
+func (b *eventBatcher) add(event string, node GuiNode) {
+	b.Lock()
+	if _, ok := b.pending[event]; !ok {
+		b.order = append(b.order, event)
+	}
+	b.pending[event] = append(b.pending[event], node)
+	full := len(b.pending[event]) >= maxBatchSize
+	if !full && b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.flush)
+	}
+	b.Unlock()
+	if full {
+		b.flush()
+	}
+}
+
+// Send all pending nodes
+func (b *eventBatcher) flush() {
+	b.Lock()
+	pending, order := b.pending, b.order
+	b.pending, b.order = make(map[string][]GuiNode), nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.Unlock()
+	for _, event := range order {
+		b.emit(event, pending[event])
+	}
+}
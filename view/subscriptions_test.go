@@ -0,0 +1,97 @@
+package view
+
+import (
+	"dforum-app/security"
+	"dforum-app/storage"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestSubscriptionRegistry(t *testing.T) {
+	previous := viper.Get("security.proofofwork-level")
+	viper.Set("security.proofofwork-level", 16)
+	t.Cleanup(func() { viper.Set("security.proofofwork-level", previous) })
+	topic := storage.NewNode("Topic", "", -1, security.HashSignature{})
+	reply := storage.NewNode("Reply", "", 5, topic.GetFingerprint())
+	nested := storage.NewNode("Nested", "", 5, reply.GetFingerprint())
+	other := storage.NewNode("Other", "", 5, security.HashSignature{1})
+	nodes := map[security.HashSignature]*storage.Node{topic.GetFingerprint(): topic, reply.GetFingerprint(): reply}
+	getNode := func(id security.HashSignature) *storage.Node { return nodes[id] }
+
+	r := newSubscriptionRegistry()
+	if r.matches(reply, getNode) {
+		t.Fatal("nothing should match without subscriptions")
+	}
+	r.subscribe(topic.GetFingerprint(), false)
+	if !r.matches(reply, getNode) || r.matches(nested, getNode) {
+		t.Fatal("parent subscriptions should only match direct children")
+	}
+	r.unsubscribe(topic.GetFingerprint(), false)
+	r.subscribe(topic.GetFingerprint(), true)
+	if !r.matches(reply, getNode) || !r.matches(nested, getNode) || r.matches(other, getNode) {
+		t.Fatal("subtree subscriptions should match any descendant")
+	}
+	r.clear()
+	if r.matches(nested, getNode) {
+		t.Fatal("unsubscribed threads should not match")
+	}
+}
+
+func TestEventBatcher(t *testing.T) {
+	var lock sync.Mutex
+	batches := map[string][][]GuiNode{}
+	b := newEventBatcher(50*time.Millisecond, func(event string, nodes []GuiNode) {
+		lock.Lock()
+		defer lock.Unlock()
+		batches[event] = append(batches[event], nodes)
+	})
+
+	for i := 0; i < maxBatchSize+3; i++ {
+		b.add("new_nodes", GuiNode{})
+	}
+	b.add("new_orphans", GuiNode{})
+	lock.Lock()
+	if len(batches["new_nodes"]) != 1 || len(batches["new_nodes"][0]) != maxBatchSize {
+		t.Fatal("full batches should be sent right away")
+	}
+	lock.Unlock()
+
+	time.Sleep(200 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	if len(batches["new_nodes"]) != 2 || len(batches["new_nodes"][1]) != 3 || len(batches["new_orphans"]) != 1 {
+		t.Fatal("pending nodes should be sent after the interval:", batches)
+	}
+}
+
+func TestOrphanEvents(t *testing.T) {
+	previous := viper.Get("security.proofofwork-level")
+	viper.Set("security.proofofwork-level", 16)
+	t.Cleanup(func() { viper.Set("security.proofofwork-level", previous) })
+	os.RemoveAll("../test/view-orphans/")
+	sM := storage.NewStorageModule("../test/view-orphans/")
+	defer sM.TearDown()
+	events := map[string][]GuiNode{}
+	vh := &ViewHandler{storageModule: sM, subscriptions: newSubscriptionRegistry()}
+	vh.events = newEventBatcher(time.Hour, func(event string, nodes []GuiNode) {
+		events[event] = append(events[event], nodes...)
+	})
+	sM.Subscribe(vh)
+
+	topic := storage.NewNode("Topic", "", -1, security.HashSignature{})
+	reply := storage.NewNode("Reply", "", 5, topic.GetFingerprint())
+	sM.StoreAndRegisterNewNode(reply)
+	vh.events.flush()
+	if len(events["new_orphans"]) != 1 || !events["new_orphans"][0].ContextLoading {
+		t.Fatal("replies received before their parent should be sent as orphans:", events)
+	}
+	sM.StoreAndRegisterNewNode(topic)
+	vh.events.flush()
+	if resolved := events["orphans_resolved"]; len(resolved) != 1 || resolved[0].ID != events["new_orphans"][0].Parent || resolved[0].ContextLoading {
+		t.Fatal("the missing parent should be sent once received:", events)
+	}
+}
@@ -1,13 +1,15 @@
 package view
 
 import (
+	"crypto/rand"
 	"dforum-app/configuration"
+	"dforum-app/render"
 	"dforum-app/security"
 	"dforum-app/storage"
 	"encoding/base64"
-	"math/rand"
+	"encoding/binary"
+	"strings"
 
-	bloom "github.com/bits-and-blooms/bloom/v3"
 	"github.com/wailsapp/wails"
 )
 
@@ -15,18 +17,48 @@ import (
 	This file acts as a link between the presentation and the data layers
 */
 
+// Children listed per request, as many as the default of storage
+const maxGuiChildren = 50
+
 type GuiNode struct {
-	ID        string
-	Parent    string
-	Short     string
-	Long      string
+	ID     string
+	Parent string
+	Short  string
+	Long   string
+	// Long rendered from Markdown to sanitized HTML
+	LongHTML  string
 	Indicator int
+	Timestamp int64
+	// Number of direct replies and of all nodes below this one
+	Replies     int
+	Descendants int
+	// Most recent timestamp of the thread below this node, the node included
+	LastActivity int64
+	// Number of ancestors, 0 for topics
+	Depth int
+	// Proof of work difficulty of the node in bits
+	Difficulty int
+	// Set for nodes whose parent has not been received yet
+	ContextLoading bool
+	Attachments    []GuiAttachment
+	// Results of polls are fetched with GetPollResults
+	IsPoll bool
+}
+
+// Subtree of a node, the root first and every parent before its children
+type GuiThread struct {
+	Nodes []GuiNode
+	// Set when nodes deeper or beyond the node limit were left out
+	Truncated bool
 }
 
 type ViewHandler struct {
 	storageModule *storage.StorageModule
-	// Remember all hashes registered on the GUI -> uses the base hash and NOT base64URL ones
-	filter       *bloom.BloomFilter
+	// Nodes opened on the GUI, only their new descendants are pushed to it
+	subscriptions *subscriptionRegistry
+	events        *eventBatcher
+	// Seed of the random order, kept for the session so that lists do not reorder on refresh
+	sessionSeed  uint64
 	wailsRuntime *wails.Runtime
 }
 
@@ -38,17 +70,21 @@ func (vh *ViewHandler) WailsInit(runtime *wails.Runtime) error {
 func NewViewHandler(storage *storage.StorageModule) *ViewHandler {
 	vh := &ViewHandler{
 		storageModule: storage,
-		filter:        bloom.NewWithEstimates(10000, 0.01),
+		subscriptions: newSubscriptionRegistry(),
+		sessionSeed:   newSessionSeed(),
 	}
+	vh.events = newEventBatcher(batchInterval, vh.emit)
 	// Subscribe to storage to be updated with incoming nodes from the network
 	// Enables real time updating of the GUI
 	storage.Subscribe(vh)
 	return vh
 }
 
-func (vh *ViewHandler) GetAllTopics() []GuiNode {
+// Orders are newest, oldest, active, agreed, contested and random, the default
+func (vh *ViewHandler) GetAllTopics(order string) []GuiNode {
 	parentNodes := vh.storageModule.GetTopLevelNodes()
-	return nodesToGuiNodes(parentNodes)
+	vh.storageModule.SortNodes(parentNodes, vh.parseOrder(order), vh.sessionSeed)
+	return vh.nodesToGuiNodes(parentNodes)
 }
 
 func (vh *ViewHandler) CreateTopic(topic string, detail string) {
@@ -61,53 +97,153 @@ func (vh *ViewHandler) CreateNode(topic string, detail string, indicator int, pa
 	vh.storageModule.StoreAndRegisterNewNode(newNode)
 }
 
-func (vh *ViewHandler) GetChildren(base64Id string) []GuiNode {
+func (vh *ViewHandler) GetChildren(base64Id string, order string) []GuiNode {
 	hashId := hashFromBase64(base64Id)
-	// Register parent when children are fetched
-	vh.filter.Add(hashId[:])
-	childrenNodes := vh.storageModule.GetChildrenNodes(hashId, false, -1)
-	return nodesToGuiNodes(childrenNodes)
+	childrenNodes := vh.storageModule.GetSortedChildrenNodes(hashId, vh.parseOrder(order), vh.sessionSeed, maxGuiChildren)
+	return vh.nodesToGuiNodes(childrenNodes)
 }
 
+// Fetch a whole discussion in one call, up to maxDepth levels below the node.
+// The depth and the number of nodes are limited by the config.
+func (vh *ViewHandler) GetThread(base64Id string, maxDepth int, order string) GuiThread {
+	depthLimit, nodeLimit := configuration.GetThreadLimits()
+	if maxDepth <= 0 || maxDepth > depthLimit {
+		maxDepth = depthLimit
+	}
+	thread := vh.storageModule.GetThread(hashFromBase64(base64Id), maxDepth, nodeLimit, vh.parseOrder(order), vh.sessionSeed)
+	guiThread := GuiThread{Nodes: []GuiNode{}, Truncated: thread.Truncated}
+	for _, n := range thread.Nodes {
+		guiThread.Nodes = append(guiThread.Nodes, vh.convertNode(n.Node))
+	}
+	return guiThread
+}
+
+// Render the discussion below a node as a Markdown or HTML document, for the GUI to save
+func (vh *ViewHandler) ExportThread(base64Id string, format string) (string, error) {
+	thread := vh.storageModule.GetThread(hashFromBase64(base64Id), render.MaxDepth, render.MaxNodes, storage.OrderOldest, 0)
+	document := &strings.Builder{}
+	if err := render.RenderThread(document, thread, render.Format(format)); err != nil {
+		return "", err
+	}
+	return document.String(), nil
+}
+
+// Get nodes received before their parent, their context is still being fetched
+func (vh *ViewHandler) GetOrphans() []GuiNode {
+	guiNodes := []GuiNode{}
+	for _, v := range vh.storageModule.GetOrphanNodes() {
+		if !v.IsVote() {
+			guiNodes = append(guiNodes, vh.convertNode(v))
+		}
+	}
+	return guiNodes
+}
+
+// Push the new direct children of a node to the GUI
+func (vh *ViewHandler) Subscribe(base64Id string) {
+	vh.subscriptions.subscribe(hashFromBase64(base64Id), false)
+}
+
+func (vh *ViewHandler) Unsubscribe(base64Id string) {
+	vh.subscriptions.unsubscribe(hashFromBase64(base64Id), false)
+}
+
+// Push any new descendant of a node to the GUI, such as all replies within a topic
+func (vh *ViewHandler) SubscribeSubtree(base64Id string) {
+	vh.subscriptions.subscribe(hashFromBase64(base64Id), true)
+}
+
+func (vh *ViewHandler) UnsubscribeSubtree(base64Id string) {
+	vh.subscriptions.unsubscribe(hashFromBase64(base64Id), true)
+}
+
+func (vh *ViewHandler) UnsubscribeAll() {
+	vh.subscriptions.clear()
+}
+
+// Queue new nodes of subscribed threads and orphans, they are sent to the GUI
+// in batches as new_nodes and new_orphans events. Votes on subscribed polls are sent as poll_updated events.
+// Nodes received after their children are sent as orphans_resolved events, giving orphans their missing parent.
 func (vh *ViewHandler) RegisterNewNode(node *storage.Node) {
 	if node == nil {
 		return
 	}
-	hashId := node.DatObj.Parent
-	if vh.filter.Test(hashId[:]) {
-		guiNode := convertNode(node)
-		vh.wailsRuntime.Events.Emit("new_node", guiNode)
+	// Votes update the results of their poll rather than being listed
+	if node.IsVote() {
+		vh.registerNewVote(node)
+		return
+	}
+	if len(vh.storageModule.GetChildrenIDs(node.GetFingerprint())) > 0 {
+		vh.events.add("orphans_resolved", vh.convertNode(node))
+	}
+	if vh.storageModule.IsOrphan(node) {
+		vh.events.add("new_orphans", vh.convertNode(node))
+		return
+	}
+	getNode := func(id security.HashSignature) *storage.Node {
+		return vh.storageModule.GetNode(id, false)
+	}
+	if vh.subscriptions.matches(node, getNode) {
+		vh.events.add("new_nodes", vh.convertNode(node))
 	}
 }
 
-// Converts storage nodes into a GUI compatible data struct
-// Shuffles the resulting array to avoid always showing nodes in the same order
-func nodesToGuiNodes(nodes []*storage.Node) []GuiNode {
+func (vh *ViewHandler) emit(event string, nodes []GuiNode) {
+	if vh.wailsRuntime != nil {
+		vh.wailsRuntime.Events.Emit(event, nodes)
+	}
+}
+
+// Converts storage nodes into a GUI compatible data struct, keeping their order
+func (vh *ViewHandler) nodesToGuiNodes(nodes []*storage.Node) []GuiNode {
 	guiNodes := []GuiNode{}
 	for _, v := range nodes {
-		if v == nil {
+		if v == nil || v.IsVote() {
 			continue
 		}
-		guiNodes = append(guiNodes, convertNode(v))
-	}
-	// https://en.wikipedia.org/wiki/Fisher%E2%80%93Yates_shuffle
-	for i := range guiNodes { // Shuffle
-		j := rand.Intn(i + 1)
-		guiNodes[i], guiNodes[j] = guiNodes[j], guiNodes[i]
+		guiNodes = append(guiNodes, vh.convertNode(v))
 	}
 	return guiNodes
 }
 
-func convertNode(node *storage.Node) GuiNode {
+// Unknown orders fall back to the random order, which avoids always showing the same nodes first
+func (vh *ViewHandler) parseOrder(order string) storage.SortOrder {
+	sortOrder, ok := storage.ParseSortOrder(order)
+	if !ok && order != "" {
+		configuration.Logger.Info("unknown sort order: ", order)
+	}
+	return sortOrder
+}
+
+func newSessionSeed() uint64 {
+	seed := make([]byte, 8)
+	rand.Read(seed)
+	return binary.BigEndian.Uint64(seed)
+}
+
+// Counters come from the stats maintained by storage, the depth is unknown for orphans
+func (vh *ViewHandler) convertNode(node *storage.Node) GuiNode {
 	if node == nil {
 		return GuiNode{}
 	}
+	stats := vh.storageModule.GetNodeStats(node.GetFingerprint())
+	depth, complete := vh.storageModule.GetDepth(node)
 	return GuiNode{
-		ID:        base64.URLEncoding.EncodeToString(node.SecObj.Fingerprint[:]),
-		Parent:    base64.URLEncoding.EncodeToString(node.DatObj.Parent[:]),
-		Short:     node.DatObj.Topic,
-		Long:      node.DatObj.Content,
-		Indicator: int(node.DatObj.Indicator),
+		ID:             base64.URLEncoding.EncodeToString(node.SecObj.Fingerprint[:]),
+		Parent:         base64.URLEncoding.EncodeToString(node.DatObj.Parent[:]),
+		Short:          node.DatObj.Topic,
+		Long:           node.DatObj.Content,
+		LongHTML:       render.Markdown(node.DatObj.Content, render.MarkdownOptions{RemoteImages: configuration.AreRemoteImagesAllowed()}),
+		Indicator:      int(node.DatObj.Indicator),
+		Timestamp:      node.GetTimestamp(),
+		Replies:        stats.Replies,
+		Descendants:    stats.Descendants,
+		LastActivity:   stats.LastActivity,
+		Depth:          depth,
+		Difficulty:     node.SecObj.Difficulty(),
+		ContextLoading: !complete,
+		Attachments:    vh.convertAttachments(node),
+		IsPoll:         node.IsPoll(),
 	}
 }
 